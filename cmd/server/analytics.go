@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// searchEvent is one served /search, the raw material for offline relevance
+// evaluation and click modeling.
+type searchEvent struct {
+	Time       time.Time `json:"time"`
+	Query      string    `json:"query"`
+	Rewrite    string    `json:"rewrite"`
+	Variant    string    `json:"variant,omitempty"`
+	IDs        []uint    `json:"ids"`
+	Scores     []float64 `json:"scores"`
+	TookMs     float64   `json:"tookMs"`
+	TooGeneric bool      `json:"tooGeneric,omitempty"`
+}
+
+// analyticsHook receives every /search event. It is called on the request
+// path, so it must not block.
+type analyticsHook func(searchEvent)
+
+// analyticsSink writes events to w as NDJSON from a background goroutine.
+// Events are queued on a buffered channel and dropped (and counted) when
+// the queue is full, so a slow disk never slows searches down.
+type analyticsSink struct {
+	ch      chan searchEvent
+	dropped atomic.Int64
+}
+
+// openAnalytics starts a sink writing to the file at path, or to stdout
+// when path is "-".
+func openAnalytics(path string, buffer int) (*analyticsSink, error) {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	s := &analyticsSink{ch: make(chan searchEvent, max(buffer, 1))}
+	go s.run(w)
+	return s, nil
+}
+
+func (s *analyticsSink) run(w io.Writer) {
+	enc := json.NewEncoder(w)
+	for e := range s.ch {
+		if err := enc.Encode(e); err != nil {
+			log.Printf("analytics: %v", err)
+		}
+	}
+}
+
+// send queues e for writing; it is the sink's analyticsHook.
+func (s *analyticsSink) send(e searchEvent) {
+	select {
+	case s.ch <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many events were discarded because the queue was full.
+func (s *analyticsSink) Dropped() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.dropped.Load()
+}
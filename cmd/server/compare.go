@@ -0,0 +1,58 @@
+package main
+
+import "gocom_fuzzy_search/searchindex"
+
+// compareSide is one search of a /compare request. Flags are per-request
+// scoring overrides, as in experimentFlags, e.g. {"weight.fuzzy": "0.5"}.
+type compareSide struct {
+	Query string            `json:"query"`
+	Flags map[string]string `json:"flags,omitempty"`
+}
+
+// rankChange is a product returned by both searches of a /compare.
+// Ranks are 1-based; Delta is RankA-RankB, so positive means it moved up
+// in B.
+type rankChange struct {
+	ID    uint `json:"id"`
+	RankA int  `json:"rankA"`
+	RankB int  `json:"rankB"`
+	Delta int  `json:"delta"`
+}
+
+// resultDiff compares two rankings of the same catalog.
+type resultDiff struct {
+	Changed   []rankChange `json:"changed"` // in both, at different ranks
+	Unchanged int          `json:"unchanged"`
+	OnlyA     []uint       `json:"onlyA"`
+	OnlyB     []uint       `json:"onlyB"`
+}
+
+// diffResults reports how b's ranking differs from a's, in a's order for
+// products in both and each side's own order otherwise.
+func diffResults(a, b []searchindex.SearchResult) resultDiff {
+	d := resultDiff{Changed: []rankChange{}, OnlyA: []uint{}, OnlyB: []uint{}}
+	rankB := make(map[uint]int, len(b))
+	for i, r := range b {
+		rankB[r.Product.ID] = i + 1
+	}
+	inA := make(map[uint]bool, len(a))
+	for i, r := range a {
+		id := r.Product.ID
+		inA[id] = true
+		rb, ok := rankB[id]
+		switch {
+		case !ok:
+			d.OnlyA = append(d.OnlyA, id)
+		case rb == i+1:
+			d.Unchanged++
+		default:
+			d.Changed = append(d.Changed, rankChange{ID: id, RankA: i + 1, RankB: rb, Delta: i + 1 - rb})
+		}
+	}
+	for _, r := range b {
+		if !inA[r.Product.ID] {
+			d.OnlyB = append(d.OnlyB, r.Product.ID)
+		}
+	}
+	return d
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// limiter caps how many requests a handler serves at once. Requests over
+// the cap wait up to wait for a slot, then get 503 with Retry-After.
+type limiter struct {
+	slots chan struct{}
+	wait  time.Duration
+	m     *metrics
+}
+
+// newLimiter returns a limiter for n concurrent requests; n <= 0 disables
+// limiting.
+func newLimiter(n int, wait time.Duration, m *metrics) *limiter {
+	l := &limiter{wait: wait, m: m}
+	if n > 0 {
+		l.slots = make(chan struct{}, n)
+	}
+	return l
+}
+
+func (l *limiter) wrap(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if l.slots != nil && !l.acquire(r) {
+			l.m.searchRejected.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, int(l.wait.Seconds()))))
+			http.Error(w, "too many concurrent searches", http.StatusServiceUnavailable)
+			return
+		}
+		l.m.searchInflight.Add(1)
+		defer func() {
+			l.m.searchInflight.Add(-1)
+			if l.slots != nil {
+				<-l.slots
+			}
+		}()
+		h(w, r)
+	}
+}
+
+func (l *limiter) acquire(r *http.Request) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.wait <= 0 {
+		return false
+	}
+	t := time.NewTimer(l.wait)
+	defer t.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-t.C:
+	case <-r.Context().Done():
+	}
+	return false
+}
@@ -1,19 +1,30 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"maps"
+	"mime"
 	"net/http"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	genai "github.com/google/generative-ai-go/genai"
 	"github.com/joho/godotenv"
 	"gocom_fuzzy_search/nlp"
 	"google.golang.org/api/option"
+	unified "google.golang.org/genai"
 
 	"gocom_fuzzy_search/models"      // your Product model
 	"gocom_fuzzy_search/searchindex" // the engine above
@@ -27,20 +38,429 @@ func main() {
 	}
 
 	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		log.Fatalf("genai.NewClient: %v", err)
-	}
-	defer client.Close()
 
 	rewriterModelName := getenvDefault("QUERY_REWRITER_MODEL", "gemini-1.5-flash")
-	rewriter := client.GenerativeModel(rewriterModelName)
-
+	// QUERY_REWRITER_FALLBACK_MODELS, e.g. "gemini-1.5-flash-8b,gemini-1.0-pro",
+	// are tried in order when the rewriter model is rate-limited or failing.
+	rewriterModels := []string{rewriterModelName}
+	for _, m := range strings.Split(os.Getenv("QUERY_REWRITER_FALLBACK_MODELS"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			rewriterModels = append(rewriterModels, m)
+		}
+	}
 	modelName := getenvDefault("EMBEDDING_MODEL", "text-embedding-004")
+	// EMBEDDING_FALLBACK_MODELS are tried in order when EMBEDDING_MODEL
+	// fails. Only list models that embed into the same space, e.g. the same
+	// model under another name or version alias; a different model's
+	// vectors don't compare with the indexed ones.
+	var embedFallbacks []string
+	for _, m := range strings.Split(os.Getenv("EMBEDDING_FALLBACK_MODELS"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			embedFallbacks = append(embedFallbacks, m)
+		}
+	}
 	semW := parseFloatDefault(os.Getenv("SEMANTIC_WEIGHT"), 0.70)
 	fuzW := parseFloatDefault(os.Getenv("FUZZY_WEIGHT"), 0.30)
 
-	ix := searchindex.New(ctx, client, modelName, semW, fuzW)
+	// GENAI_SDK picks the Gemini client: "legacy" (github.com/google/generative-ai-go,
+	// deprecated) or "unified" (google.golang.org/genai).
+	var (
+		rewriter nlp.FallbackGenerator
+		embedder searchindex.Embedder
+		imageEm  searchindex.ImageEmbedder
+	)
+	// IMAGE_EMBEDDING_MODEL names a multimodal embedding model for product
+	// images (unified SDK only); IMAGE_WEIGHT sets how much it counts.
+	imageModel := os.Getenv("IMAGE_EMBEDDING_MODEL")
+	httpClient := genaiHTTPClient()
+	switch sdk := getenvDefault("GENAI_SDK", "legacy"); sdk {
+	case "legacy":
+		keyed := *httpClient
+		keyed.Transport = apiKeyTransport{key: apiKey, base: httpClient.Transport}
+		// The API key option is still needed for the SDK's gRPC cache client,
+		// which doesn't use the custom HTTP client.
+		client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey), option.WithHTTPClient(&keyed))
+		if err != nil {
+			log.Fatalf("genai.NewClient: %v", err)
+		}
+		defer client.Close()
+		for _, m := range rewriterModels {
+			rewriter = append(rewriter, nlp.NewLegacyGenerator(client.GenerativeModel(m)))
+		}
+		embedder = searchindex.NewLegacyEmbedder(client, modelName)
+		if len(embedFallbacks) > 0 {
+			ems := []searchindex.Embedder{embedder}
+			for _, m := range embedFallbacks {
+				ems = append(ems, searchindex.NewLegacyEmbedder(client, m))
+			}
+			embedder = searchindex.NewFallbackEmbedder(ems...)
+		}
+	case "unified":
+		client, err := unified.NewClient(ctx, &unified.ClientConfig{
+			APIKey:     apiKey,
+			Backend:    unified.BackendGeminiAPI,
+			HTTPClient: httpClient,
+		})
+		if err != nil {
+			log.Fatalf("genai.NewClient: %v", err)
+		}
+		for _, m := range rewriterModels {
+			rewriter = append(rewriter, nlp.NewUnifiedGenerator(client, m))
+		}
+		embedder = searchindex.NewUnifiedEmbedder(client, modelName)
+		if len(embedFallbacks) > 0 {
+			ems := []searchindex.Embedder{embedder}
+			for _, m := range embedFallbacks {
+				ems = append(ems, searchindex.NewUnifiedEmbedder(client, m))
+			}
+			embedder = searchindex.NewFallbackEmbedder(ems...)
+		}
+		if imageModel != "" {
+			imageEm = searchindex.NewUnifiedImageEmbedder(client, imageModel, httpClient)
+		}
+	default:
+		log.Fatalf("unknown GENAI_SDK %q (want legacy or unified)", sdk)
+	}
+
+	ix := searchindex.NewWithEmbedder(embedder, modelName, semW, fuzW)
+	if imageEm != nil {
+		ix.SetImageEmbedder(imageEm)
+	} else if imageModel != "" {
+		log.Printf("IMAGE_EMBEDDING_MODEL needs GENAI_SDK=unified; image embeddings disabled")
+	}
+
+	rewriteOpts := nlp.DefaultRewriteOptions()
+	// Set REWRITER_JSON_MODE=false for models without structured output.
+	rewriteOpts.JSONMode = getenvDefault("REWRITER_JSON_MODE", "true") == "true"
+	if v := os.Getenv("REWRITER_TEMPERATURE"); v != "" {
+		t := float32(parseFloatDefault(v, float64(*rewriteOpts.Temperature)))
+		rewriteOpts.Temperature = &t
+	}
+	if v := os.Getenv("REWRITER_TOP_P"); v != "" {
+		p := float32(parseFloatDefault(v, 1))
+		rewriteOpts.TopP = &p
+	}
+	rewriteOpts.MaxOutputTokens = int32(parseIntDefault(os.Getenv("REWRITER_MAX_OUTPUT_TOKENS"), int(rewriteOpts.MaxOutputTokens)))
+	altMinScore := parseFloatDefault(os.Getenv("ALTERNATIVES_MIN_SCORE"), 0.6)
+	// ALTERNATIVES_MODE=centroid searches the primary query and its
+	// alternatives (each weighted ALTERNATIVE_WEIGHT, default 0.5) as one
+	// blended query instead of one search per alternative (merge, the
+	// default). It is cheaper; compare relevance before switching, since a
+	// blend of unrelated alternatives can miss both meanings.
+	altMode := getenvDefault("ALTERNATIVES_MODE", "merge")
+	altWeight := parseFloatDefault(os.Getenv("ALTERNATIVE_WEIGHT"), 0.5)
+	// RESPONSE_MAX_ALTERNATIVES caps the alternatives echoed in /search's
+	// "normalized" field, e.g. to what the UI renders; all of them are
+	// still searched. Negative (default) echoes every one.
+	responseMaxAlts := parseIntDefault(os.Getenv("RESPONSE_MAX_ALTERNATIVES"), -1)
+	fanout := parseIntDefault(os.Getenv("SEARCH_FANOUT"), 3)
+	if fanout < 1 {
+		fanout = 1
+	}
+
+	// TRANSLATE_QUERIES=true translates queries into CATALOG_LANGUAGE
+	// (default English) before rewriting. Each new query costs one extra
+	// Gemini call, typically a few hundred ms, ahead of the rewrite;
+	// results are cached (TRANSLATION_CACHE_SIZE queries). If translation
+	// fails the original query is searched.
+	var translator *nlp.Translator
+	if os.Getenv("TRANSLATE_QUERIES") == "true" {
+		translator = nlp.NewTranslator(rewriter, nlp.TranslateOptions{
+			Target:    getenvDefault("CATALOG_LANGUAGE", "English"),
+			CacheSize: parseIntDefault(os.Getenv("TRANSLATION_CACHE_SIZE"), 10000),
+			JSONMode:  rewriteOpts.JSONMode,
+		})
+	}
+
+	// Spelling corrections below REWRITE_MIN_CONFIDENCE are not applied and
+	// the raw query is searched instead; 0 applies every correction.
+	rewriteMinConfidence := parseFloatDefault(os.Getenv("REWRITE_MIN_CONFIDENCE"), 0.6)
+	// QUERY_REWRITE=false skips the LLM rewrite and searches the raw
+	// query, saving a model round-trip per search; /search?rewrite=
+	// overrides it per request. Misspelled queries then rely on fuzzy
+	// matching alone, unless LOCAL_CORRECTION is on, and get no
+	// alternatives, so expect weaker results for typos and vague queries.
+	rewriteDefault := os.Getenv("QUERY_REWRITE") != "false"
+	// LOCAL_CORRECTION=true spell-corrects against the indexed vocabulary
+	// when the rewriter failed, its reply was unusable or it was skipped.
+	localCorrection := os.Getenv("LOCAL_CORRECTION") == "true"
+	// PRICE_INTENT=true turns price phrases like "under 50000" or
+	// "between 200 and 500" in queries into price filters.
+	priceIntentOn := os.Getenv("PRICE_INTENT") == "true"
+
+	cfg := ix.Config()
+	// Recommended 2–3; 0 keeps every query token in the fuzzy comparison.
+	cfg.MinFuzzyTokenLen = parseIntDefault(os.Getenv("FUZZY_MIN_TOKEN_LEN"), 0)
+	cfg.BrandBoost = parseFloatDefault(os.Getenv("BRAND_BOOST"), 0)
+	cfg.CombinedBoost = parseFloatDefault(os.Getenv("COMBINED_BOOST"), 0)
+	cfg.CategoryBoost = parseFloatDefault(os.Getenv("CATEGORY_BOOST"), 0)
+	// SEARCH_FUZZY_ONLY_FALLBACK=true ranks on fuzzy matching alone when
+	// the query can't be embedded, rather than failing the search.
+	cfg.FuzzyOnlyFallback = os.Getenv("SEARCH_FUZZY_ONLY_FALLBACK") == "true"
+	cfg.MinSemantic = parseFloatDefault(os.Getenv("MIN_SEMANTIC_SIMILARITY"), 0)
+	// SEARCH_MIN_RESULTS=N relaxes filtered searches returning fewer than
+	// N results by dropping the filters in SEARCH_RELAXATION in order
+	// (default "minScore"; also price, recency, category, status).
+	// SEARCH_MIN_CONFIDENCE answers with no results, flagged
+	// noConfidentMatch, when even the best result scores below it.
+	cfg.MinConfidence = parseFloatDefault(os.Getenv("SEARCH_MIN_CONFIDENCE"), 0)
+	cfg.MinResults = parseIntDefault(os.Getenv("SEARCH_MIN_RESULTS"), 0)
+	cfg.Relaxation = nil
+	for _, s := range strings.Split(getenvDefault("SEARCH_RELAXATION", searchindex.ExcludedMinScore), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			cfg.Relaxation = append(cfg.Relaxation, s)
+		}
+	}
+	// SEARCH_PARTIAL_MARGIN (e.g. "2s") answers with partial results
+	// instead of failing when a search nears its deadline.
+	cfg.PartialMargin = searchindex.Duration(parseDurationDefault(os.Getenv("SEARCH_PARTIAL_MARGIN"), 0))
+	// SEARCH_TIEBREAKERS orders equal scores, e.g.
+	// "updated_desc,rating_desc,id_asc" (default id_asc).
+	cfg.Tiebreakers = nil
+	for _, t := range strings.Split(os.Getenv("SEARCH_TIEBREAKERS"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			cfg.Tiebreakers = append(cfg.Tiebreakers, t)
+		}
+	}
+	cfg.ShuffleEpsilon = parseFloatDefault(os.Getenv("SEARCH_SHUFFLE_EPSILON"), 0)
+	cfg.MaxDescriptionLen = parseIntDefault(os.Getenv("MAX_DESCRIPTION_LEN"), 0)
+	cfg.StripHTML = os.Getenv("STRIP_HTML") == "true"
+	cfg.EmbedTimeout = searchindex.Duration(parseDurationDefault(os.Getenv("EMBED_TIMEOUT"), 15*time.Second))
+	// EMBED_BATCH_SIZE is how many texts go into each batch embedding call
+	// when indexing (default and maximum searchindex.MaxEmbedBatch).
+	cfg.EmbedBatchSize = parseIntDefault(os.Getenv("EMBED_BATCH_SIZE"), 0)
+	// PCA_DIMENSIONS=N reduces stored vectors to N dimensions, trading
+	// some recall for memory; see searchindex.Config.PCADimensions.
+	cfg.PCADimensions = parseIntDefault(os.Getenv("PCA_DIMENSIONS"), 0)
+	// EMBED_DOCUMENT_INSTRUCTION and EMBED_QUERY_INSTRUCTION are the
+	// prompts instruction-tuned models expect, e.g. "passage: " and
+	// "query: "; SetConfig rejects invalid ones at startup.
+	cfg.DocumentInstruction = os.Getenv("EMBED_DOCUMENT_INSTRUCTION")
+	cfg.QueryInstruction = os.Getenv("EMBED_QUERY_INSTRUCTION")
+	cfg.FieldEmbeddings = os.Getenv("FIELD_EMBEDDINGS") == "true"
+	cfg.QueryRouting = os.Getenv("QUERY_ROUTING") == "true"
+	cfg.StrictModelNumbers = os.Getenv("STRICT_MODEL_NUMBERS") == "true"
+	cfg.Calibration = os.Getenv("SCORE_CALIBRATION")
+	cfg.CalibrationMidpoint = parseFloatDefault(os.Getenv("SCORE_CALIBRATION_MIDPOINT"), cfg.CalibrationMidpoint)
+	cfg.CalibrationSteepness = parseFloatDefault(os.Getenv("SCORE_CALIBRATION_STEEPNESS"), cfg.CalibrationSteepness)
+	cfg.ContextWeight = parseFloatDefault(os.Getenv("SEARCH_CONTEXT_WEIGHT"), cfg.ContextWeight)
+	cfg.QueryCacheBytes = int64(parseIntDefault(os.Getenv("QUERY_CACHE_MAX_BYTES"), 64<<20))
+	// QUERY_HISTORY_SIZE=N opts in to suggesting popular past queries
+	// (/suggest?source=queries). Queries stay in memory only, but they are
+	// shown to other users: keep QUERY_HISTORY_MIN_COUNT (default 2) above
+	// 1 so a query nobody else typed is never suggested.
+	cfg.QueryHistorySize = parseIntDefault(os.Getenv("QUERY_HISTORY_SIZE"), 0)
+	cfg.QueryHistoryHalfLife = searchindex.Duration(parseDurationDefault(os.Getenv("QUERY_HISTORY_HALF_LIFE"), 7*24*time.Hour))
+	cfg.QueryHistoryMinCount = parseIntDefault(os.Getenv("QUERY_HISTORY_MIN_COUNT"), 2)
+	// SEARCH_TOKENIZER=cjk for catalogs with Chinese, Japanese or Korean text.
+	cfg.Tokenizer = getenvDefault("SEARCH_TOKENIZER", cfg.Tokenizer)
+	cfg.JoinCompounds = os.Getenv("TOKENIZER_JOIN_COMPOUNDS") == "true"
+	cfg.SplitScripts = os.Getenv("TOKENIZER_SPLIT_SCRIPTS") == "true"
+	cfg.FuzzyCombined = os.Getenv("FUZZY_COMBINED") == "true"
+	cfg.PrefixWeight = parseFloatDefault(os.Getenv("FUZZY_PREFIX_WEIGHT"), cfg.PrefixWeight)
+	cfg.TitlePrefixWeight = parseFloatDefault(os.Getenv("TITLE_PREFIX_WEIGHT"), cfg.TitlePrefixWeight)
+	// SEARCH_WEIGHTS sets any signal's weight, e.g.
+	// "semantic=0.6,fuzzy=0.2,lexical=0.2".
+	if w := envWeights("SEARCH_WEIGHTS"); len(w) > 0 {
+		if cfg.Weights == nil {
+			cfg.Weights = map[string]float64{}
+		}
+		maps.Copy(cfg.Weights, w)
+	}
+	// Indexes under SMALL_CORPUS_SIZE products (e.g. the samples in local
+	// development) are flagged in /search and /info, and rank with
+	// SMALL_CORPUS_WEIGHTS, given like SEARCH_WEIGHTS.
+	cfg.SmallCorpus = parseIntDefault(os.Getenv("SMALL_CORPUS_SIZE"), cfg.SmallCorpus)
+	if w := envWeights("SMALL_CORPUS_WEIGHTS"); len(w) > 0 {
+		cfg.SmallCorpusWeights = w
+	}
+	// FIELD_NORMALIZATION replaces the pipeline of the fields it names,
+	// e.g. "brand=lowercase;description=lowercase+fold+stem"; an empty
+	// pipeline ("brand=") compares the field as it is.
+	if v := os.Getenv("FIELD_NORMALIZATION"); v != "" {
+		norms := maps.Clone(cfg.FieldNormalization)
+		if norms == nil {
+			norms = map[string][]string{}
+		}
+		for _, kv := range strings.Split(v, ";") {
+			field, pipeline, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				continue
+			}
+			var steps []string
+			for _, step := range strings.Split(pipeline, "+") {
+				if step = strings.TrimSpace(step); step != "" {
+					steps = append(steps, step)
+				}
+			}
+			norms[field] = steps
+		}
+		cfg.FieldNormalization = norms
+	}
+	// LEXICAL_SCORER=bm25 adds BM25 with weight LEXICAL_WEIGHT.
+	cfg.Lexical = getenvDefault("LEXICAL_SCORER", cfg.Lexical)
+	cfg.LexicalWeight = parseFloatDefault(os.Getenv("LEXICAL_WEIGHT"), cfg.LexicalWeight)
+	cfg.MaxDocFreq = parseFloatDefault(os.Getenv("FUZZY_MAX_DOC_FREQ"), cfg.MaxDocFreq)
+	cfg.MaxPerSeller = parseIntDefault(os.Getenv("SEARCH_MAX_PER_SELLER"), cfg.MaxPerSeller)
+	cfg.ExactMatchScore = parseFloatDefault(os.Getenv("EXACT_MATCH_SCORE"), cfg.ExactMatchScore)
+	cfg.ImageWeight = parseFloatDefault(os.Getenv("IMAGE_WEIGHT"), cfg.ImageWeight)
+	cfg.MatchTypeMargin = parseFloatDefault(os.Getenv("MATCH_TYPE_MARGIN"), cfg.MatchTypeMargin)
+	cfg.BrandRepeat = parseIntDefault(os.Getenv("EMBED_BRAND_REPEAT"), cfg.BrandRepeat)
+	// AVAILABILITY_BOOST=1.2 AVAILABLE_STATUSES=1 lifts in-stock products.
+	cfg.AvailabilityBoost = parseFloatDefault(os.Getenv("AVAILABILITY_BOOST"), cfg.AvailabilityBoost)
+	cfg.ConversionBoost = parseFloatDefault(os.Getenv("CONVERSION_BOOST"), cfg.ConversionBoost)
+	for _, v := range strings.Split(os.Getenv("AVAILABLE_STATUSES"), ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			cfg.AvailableStatuses = append(cfg.AvailableStatuses, n)
+		}
+	}
+	// SEARCH_STOP_WORDS replaces the default stop-word list, e.g.
+	// "the,a,of,de,la"; "none" keeps only the punctuation check.
+	switch v := os.Getenv("SEARCH_STOP_WORDS"); v {
+	case "":
+	case "none":
+		cfg.StopWords = nil
+	default:
+		cfg.StopWords = strings.Split(v, ",")
+	}
+	// FUZZY_METRIC: jaro-winkler (default), levenshtein, ngram or tokenset.
+	// SCORE_BLEND: weighted-sum (default) or rrf.
+	cfg.FuzzyMetric = getenvDefault("FUZZY_METRIC", cfg.FuzzyMetric)
+	// FUZZY_TOKEN_SET combines the fuzzy metric with the word-order-free
+	// token-set score: max (default) takes the higher of the two, blend
+	// mixes them with weight FUZZY_TOKEN_SET_WEIGHT, and off uses the
+	// metric alone.
+	switch v := os.Getenv("FUZZY_TOKEN_SET"); v {
+	case "":
+	case "off":
+		cfg.TokenSet = ""
+	default:
+		cfg.TokenSet = v // SetConfig rejects unknown values
+	}
+	cfg.TokenSetWeight = parseFloatDefault(os.Getenv("FUZZY_TOKEN_SET_WEIGHT"), cfg.TokenSetWeight)
+	cfg.Blend = getenvDefault("SCORE_BLEND", cfg.Blend)
+	if err := ix.SetConfig(cfg); err != nil {
+		log.Fatalf("search config: %v", err)
+	}
+	// The catalog's Score column is the product rating; expose it to
+	// /search?sort= alongside the built-in fields.
+	ix.RegisterSortField("rating", func(p searchindex.Product) float64 { return float64(p.Score) })
+	// With EMBED_FULL_MIN_SCORE, only products scoring at least that embed
+	// every field; the rest embed their title plus EMBED_LOW_SCORE_FIELDS
+	// (comma-separated: brand, description, variants), to save embedding
+	// cost on the long tail.
+	if v := os.Getenv("EMBED_FULL_MIN_SCORE"); v != "" {
+		minScore, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("EMBED_FULL_MIN_SCORE: %v", err)
+		}
+		fields := []string{}
+		for _, f := range strings.Split(os.Getenv("EMBED_LOW_SCORE_FIELDS"), ",") {
+			switch f = strings.TrimSpace(f); f {
+			case "":
+			case searchindex.EmbedBrand, searchindex.EmbedDescription, searchindex.EmbedVariants:
+				fields = append(fields, f)
+			default:
+				log.Fatalf("EMBED_LOW_SCORE_FIELDS: unknown field %q", f)
+			}
+		}
+		ix.SetFieldSelector(searchindex.ScoreFieldSelector(minScore, fields...))
+	}
+
+	// Optional JSON file overlaying the tunables above; it is re-read when
+	// it changes so relevance can be tuned without a restart.
+	if path := os.Getenv("SEARCH_CONFIG_FILE"); path != "" {
+		fileCfg, err := loadConfigFile(path, cfg)
+		if err != nil {
+			log.Fatalf("search config: %v", err)
+		}
+		if err := ix.SetConfig(fileCfg); err != nil {
+			log.Fatalf("search config: %v", err)
+		}
+		interval := time.Duration(parseIntDefault(os.Getenv("SEARCH_CONFIG_RELOAD_SECONDS"), 5)) * time.Second
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		go watchConfig(ctx, path, interval, cfg, ix)
+	}
+	if b, err := json.Marshal(ix.Config()); err == nil {
+		log.Printf("search config: %s", b)
+	}
+
+	// INDEX_SNAPSHOT_PATH persists the index after every reindex and
+	// restores it at startup, skipping re-embedding. INDEX_SNAPSHOT_FORMAT
+	// is gob (default, compact) or json (inspectable). A snapshot from a
+	// different EMBEDDING_MODEL is refused.
+	snapshotPath := os.Getenv("INDEX_SNAPSHOT_PATH")
+	codec, err := snapshotCodec(os.Getenv("INDEX_SNAPSHOT_FORMAT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if snapshotPath != "" {
+		if err := loadSnapshot(ix, snapshotPath, codec); err != nil {
+			log.Printf("snapshot %s not loaded: %v", snapshotPath, err)
+		}
+	}
+	afterReindex := func() {
+		if snapshotPath != "" {
+			saveSnapshot(ix, snapshotPath, codec)
+		}
+	}
+
+	// QUERY_LOG_PATH records a QUERY_LOG_SAMPLE share (default 1) of
+	// searched queries, rotating at QUERY_LOG_MAX_BYTES. With
+	// QUERY_WARMUP_TOP=N the N most frequent logged queries are embedded at
+	// startup so the query embedding cache (QUERY_CACHE_MAX_BYTES) starts
+	// warm. Only embeddings are warmed: the log holds queries as rewritten,
+	// and rewrites themselves aren't cached, so the first search for each
+	// query still calls the rewriter.
+	var qlog *queryLog
+	if path := os.Getenv("QUERY_LOG_PATH"); path != "" {
+		if n := parseIntDefault(os.Getenv("QUERY_WARMUP_TOP"), 0); n > 0 {
+			go warmEmbeddingsFromQueryLog(ctx, ix, path, n)
+		}
+		var err error
+		qlog, err = openQueryLog(path,
+			parseFloatDefault(os.Getenv("QUERY_LOG_SAMPLE"), 1),
+			int64(parseIntDefault(os.Getenv("QUERY_LOG_MAX_BYTES"), 10<<20)))
+		if err != nil {
+			log.Fatalf("query log: %v", err)
+		}
+	}
+
+	// ANALYTICS_PATH ("-" for stdout) opts in to an NDJSON event per
+	// /search, queued up to ANALYTICS_BUFFER events (default 1024) and
+	// dropped beyond that rather than slowing searches.
+	var analytics *analyticsSink
+	var onSearch analyticsHook
+	if path := os.Getenv("ANALYTICS_PATH"); path != "" {
+		var err error
+		analytics, err = openAnalytics(path, parseIntDefault(os.Getenv("ANALYTICS_BUFFER"), 1024))
+		if err != nil {
+			log.Fatalf("analytics: %v", err)
+		}
+		onSearch = analytics.send
+	}
+
+	// SCORE_PRECISION=N rounds scores in responses to N decimal places;
+	// ranking always uses full precision. 0 (default) doesn't round.
+	scorePrecision := parseIntDefault(os.Getenv("SCORE_PRECISION"), 0)
+
+	// Clients/CDNs may cache /search responses this long; the ETag changes
+	// with the index generation and the config hash, so reindexing or a
+	// config reload invalidates them anyway.
+	cacheMaxAge := parseIntDefault(os.Getenv("SEARCH_CACHE_MAX_AGE"), 60)
+
+	// RESULT_CACHE_MAX_BYTES (0 disables, the default) keeps encoded
+	// /search responses in memory for RESULT_CACHE_TTL (0 for as long as
+	// the index generation lasts), keyed by ETag and so by the config
+	// hash too, evicting by RESULT_CACHE_POLICY: lru
+	// (default) or lfu.
+	results, err := newResultCache(int64(parseIntDefault(os.Getenv("RESULT_CACHE_MAX_BYTES"), 0)),
+		parseDurationDefault(os.Getenv("RESULT_CACHE_TTL"), 0), getenvDefault("RESULT_CACHE_POLICY", evictLRU))
+	if err != nil {
+		log.Fatalf("result cache: %v", err)
+	}
 
 	// TODO: swap this with DB load via GORM (Marketplace DB)
 	initial := []models.Product{
@@ -53,46 +473,630 @@ func main() {
 		log.Fatalf("initial rebuild: %v", err)
 	}
 
+	// SYNC_SOURCE_PATH names a JSON array of products to sync from every
+	// SYNC_INTERVAL (default 1m): products updated since the last sync are
+	// re-embedded and products missing from the file are removed. With
+	// READ_THROUGH=true, /indexed and /explain fetch a product missing from
+	// the index from the source and index it on the spot, at the cost of a
+	// source read and an embedding call per missing ID.
+	var readThrough searchindex.ProductFetcher
+	var source searchindex.Loader
+	if path := os.Getenv("SYNC_SOURCE_PATH"); path != "" {
+		source = fileLoader{path: path, ix: ix}
+		interval := parseDurationDefault(os.Getenv("SYNC_INTERVAL"), time.Minute)
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		go syncLoop(ctx, ix, source, interval, afterReindex)
+		if os.Getenv("READ_THROUGH") == "true" {
+			readThrough = fileLoader{path: path, ix: ix}
+		}
+	}
+	// CONVERSION_RATES_PATH names a JSON object of product ID to click or
+	// conversion rate, reloaded when it changes (checked every
+	// CONVERSION_RATES_INTERVAL, default 5m); CONVERSION_BOOST weighs it
+	// into scores.
+	if path := os.Getenv("CONVERSION_RATES_PATH"); path != "" {
+		interval := parseDurationDefault(os.Getenv("CONVERSION_RATES_INTERVAL"), 5*time.Minute)
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+		go idMapLoop(ctx, "conversion rates", path, interval, ix.SetConversionRates)
+	}
+	// SELLER_BOOSTS_PATH names a JSON object of seller ID to score
+	// multiplier for sponsored or preferred sellers, e.g. {"7": 1.2},
+	// reloaded when it changes (checked every SELLER_BOOSTS_INTERVAL,
+	// default 5m). See searchindex.Index.SetSellerBoosts before using it.
+	if path := os.Getenv("SELLER_BOOSTS_PATH"); path != "" {
+		interval := parseDurationDefault(os.Getenv("SELLER_BOOSTS_INTERVAL"), 5*time.Minute)
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+		go idMapLoop(ctx, "seller boosts", path, interval, ix.SetSellerBoosts)
+	}
+	// ensureIndexed reads product id through to the index when enabled.
+	ensureIndexed := func(ctx context.Context, id uint) {
+		if readThrough == nil || id == 0 {
+			return
+		}
+		if _, err := ix.ReadThrough(ctx, readThrough, id); err != nil {
+			log.Printf("read-through %d: %v", id, err)
+		}
+	}
+
+	// Guard /reindex against oversized payloads. Raise both for large
+	// catalogs, e.g. REINDEX_MAX_BYTES=536870912 REINDEX_MAX_PRODUCTS=500000.
+	reindexMaxBytes := int64(parseIntDefault(os.Getenv("REINDEX_MAX_BYTES"), 32<<20))
+	reindexMaxProducts := parseIntDefault(os.Getenv("REINDEX_MAX_PRODUCTS"), 50000)
+
 	mux := http.NewServeMux()
+	m := &metrics{ix: ix, analytics: analytics, results: results}
+	mux.HandleFunc("/metrics", m.handler)
+
+	// Backpressure for /search: each one costs a rewrite, an embedding and
+	// a full scan. Requests over SEARCH_MAX_INFLIGHT queue for up to
+	// SEARCH_QUEUE_WAIT before being rejected; 0 disables the limit.
+	searchLimit := newLimiter(
+		parseIntDefault(os.Getenv("SEARCH_MAX_INFLIGHT"), 64),
+		parseDurationDefault(os.Getenv("SEARCH_QUEUE_WAIT"), 0),
+		m,
+	)
 
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
 	})
 
-	// POST /reindex  (body: JSON array of products)
+	// GET /info
+	// The embedding model and vector size behind the index, with its size
+	// and generation, to tie relevance changes to model upgrades.
+	mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			searchindex.ModelInfo
+			Products    int    `json:"products"`
+			Generation  uint64 `json:"generation"`
+			SmallCorpus bool   `json:"smallCorpus,omitempty"`
+		}{
+			ModelInfo:   ix.ModelInfo(),
+			Products:    ix.Len(),
+			Generation:  ix.Generation(),
+			SmallCorpus: ix.SmallCorpus(),
+		})
+	})
+
+	// GET /verify compares the index with SYNC_SOURCE_PATH and reports
+	// missing, extra and stale products without changing anything. It
+	// requires "Authorization: Bearer $ADMIN_TOKEN", and is closed when
+	// ADMIN_TOKEN is unset.
+	mux.HandleFunc("/verify", adminOnly(os.Getenv("ADMIN_TOKEN"), func(w http.ResponseWriter, r *http.Request) {
+		if source == nil {
+			http.Error(w, "no sync source configured (SYNC_SOURCE_PATH)", http.StatusNotFound)
+			return
+		}
+		rep, err := ix.Verify(r.Context(), source)
+		if err != nil {
+			log.Printf("verify: %v", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			OK bool `json:"ok"`
+			searchindex.VerifyReport
+		}{rep.OK(), rep})
+	}))
+
+	// GET /export/vectors streams every product's ID, vector and metadata
+	// as JSON Lines for bulk import into a vector database; see
+	// searchindex.Index.ExportVectors. It exports the whole catalog, so it
+	// requires ADMIN_TOKEN like /verify.
+	mux.HandleFunc("/export/vectors", adminOnly(os.Getenv("ADMIN_TOKEN"), func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="vectors.jsonl"`)
+		if err := ix.ExportVectors(w); err != nil {
+			// Headers are gone by now; the client sees a truncated stream.
+			log.Printf("export vectors: %v", err)
+		}
+	}))
+
+	// POST /reindex[?batchSize=50]  (body: JSON array of products)
+	// batchSize overrides EMBED_BATCH_SIZE for this reindex; /reindex/stream
+	// takes it too.
 	mux.HandleFunc("/reindex", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "POST only", http.StatusMethodNotAllowed)
 			return
 		}
+		r.Body = http.MaxBytesReader(w, r.Body, reindexMaxBytes)
 		var products []models.Product
 		if err := json.NewDecoder(r.Body).Decode(&products); err != nil {
+			var tooBig *http.MaxBytesError
+			if errors.As(err, &tooBig) {
+				http.Error(w, fmt.Sprintf("body exceeds %d bytes", reindexMaxBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
 			http.Error(w, "invalid JSON", http.StatusBadRequest)
 			return
 		}
+		if len(products) > reindexMaxProducts {
+			http.Error(w, fmt.Sprintf("at most %d products per reindex", reindexMaxProducts), http.StatusRequestEntityTooLarge)
+			return
+		}
+		b, err := reindexBuilder(ix, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("reindex: %d products, embedding batch size %d", len(products), b.BatchSize())
 		ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
 		defer cancel()
-		if err := ix.Rebuild(ctx, toIndexProducts(products)); err != nil {
+		if err := b.Add(ctx, toIndexProducts(products)); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		b.Commit()
+		afterReindex()
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	// GET /search?q=...&topK=10
-	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+	// POST /reindex/stream  (body: newline-delimited JSON products)
+	// Products are embedded in batches as they arrive, and progress is
+	// streamed back as NDJSON lines: {"embedded": n} per batch, then a final
+	// line with "done" or "error". The index only changes if the whole
+	// stream succeeds.
+	streamBatch := parseIntDefault(os.Getenv("REINDEX_STREAM_BATCH"), 100)
+	if streamBatch <= 0 {
+		streamBatch = 100
+	}
+	mux.HandleFunc("/reindex/stream", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		// Streams run as long as the client keeps sending, so the server's
+		// read/write timeouts don't apply; the client's context still does.
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(time.Time{})
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		b, err := reindexBuilder(ix, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("reindex stream: embedding batch size %d", b.BatchSize())
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		flusher, _ := w.(http.Flusher)
+		progress := func(v any) {
+			_ = enc.Encode(v)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		dec := json.NewDecoder(r.Body)
+		batch := make([]models.Product, 0, streamBatch)
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			err := b.Add(r.Context(), toIndexProducts(batch))
+			batch = batch[:0]
+			if err == nil {
+				progress(map[string]int{"embedded": b.Len()})
+			}
+			return err
+		}
+		fail := func(err error) {
+			log.Printf("reindex stream: %v", err)
+			progress(map[string]any{"error": err.Error(), "embedded": b.Len()})
+		}
+
+		for line := 1; ; line++ {
+			var p models.Product
+			if err := dec.Decode(&p); err == io.EOF {
+				break
+			} else if err != nil {
+				fail(fmt.Errorf("product %d: %w", line, err))
+				return
+			}
+			batch = append(batch, p)
+			if len(batch) >= streamBatch {
+				if err := flush(); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}
+		if err := flush(); err != nil {
+			fail(err)
+			return
+		}
+		b.Commit()
+		afterReindex()
+		progress(map[string]any{"embedded": b.Len(), "done": true})
+	})
+
+	// GET /suggest?q=gal&limit=10[&source=queries]
+	// Title completions for type-ahead, or with source=queries popular past
+	// queries (see QUERY_HISTORY_SIZE). Prefixes shorter than
+	// SUGGEST_MIN_PREFIX characters get an empty list, and limit is capped
+	// at SUGGEST_MAX_LIMIT. No Gemini calls, so it is safe per keystroke.
+	suggestMinPrefix := parseIntDefault(os.Getenv("SUGGEST_MIN_PREFIX"), 2)
+	suggestMaxLimit := parseIntDefault(os.Getenv("SUGGEST_MAX_LIMIT"), 20)
+	mux.HandleFunc("/suggest", func(w http.ResponseWriter, r *http.Request) {
+		prefix := strings.TrimSpace(r.URL.Query().Get("q"))
+		limit := min(parseIntDefault(r.URL.Query().Get("limit"), 10), suggestMaxLimit)
+		suggestions := []string{}
+		if utf8.RuneCountInString(prefix) >= suggestMinPrefix {
+			if r.URL.Query().Get("source") == "queries" {
+				suggestions = ix.SuggestQueries(prefix, limit)
+			} else {
+				suggestions = ix.Suggest(prefix, limit)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Query       string   `json:"query"`
+			Suggestions []string `json:"suggestions"`
+		}{
+			Query:       prefix,
+			Suggestions: suggestions,
+		})
+	})
+
+	// GET /indexed?id=42 (or externalId=...)
+	// Whether a product is in the index and the text embedded for it, for
+	// checking the index against the database. No embedding calls.
+	mux.HandleFunc("/indexed", func(w http.ResponseWriter, r *http.Request) {
+		id, err := requestProductID(r, ix)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ensureIndexed(r.Context(), id)
+		text, ok := ix.SearchText(id)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			ID         uint   `json:"id"`
+			Indexed    bool   `json:"indexed"`
+			SearchText string `json:"searchText,omitempty"`
+		}{
+			ID:         id,
+			Indexed:    ok,
+			SearchText: text,
+		})
+	})
+
+	// GET /explain?id=42&q=...[&status=...][&category=...][&minPrice=...][&maxPrice=...][&minScore=...]
+	// Why product id is or isn't among the results for q with the given
+	// /search filters: not indexed, the filter that drops it, or its rank
+	// and scoring. For "my product doesn't appear" tickets. externalId may
+	// be given instead of id.
+	mux.HandleFunc("/explain", func(w http.ResponseWriter, r *http.Request) {
+		id, err := requestProductID(r, ix)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		q := r.URL.Query().Get("q")
-		topK := parseIntDefault(r.URL.Query().Get("topK"), 10)
+		if strings.TrimSpace(q) == "" {
+			http.Error(w, "missing q", http.StatusBadRequest)
+			return
+		}
+		filter, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+		ensureIndexed(ctx, id)
+		ex, err := ix.Explain(ctx, q, id, searchindex.SearchOptions{Filter: filter})
+		if err != nil {
+			http.Error(w, err.Error(), searchErrorStatus(err))
+			return
+		}
+		if ex.Result != nil {
+			*ex.Result = ex.Result.Rounded(scorePrecision)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ex)
+	})
+
+	// GET /facets/values?field=brand|category
+	// Distinct brands or category IDs in the index with product counts,
+	// most common first, e.g. to fill filter dropdowns.
+	mux.HandleFunc("/facets/values", func(w http.ResponseWriter, r *http.Request) {
+		field := r.URL.Query().Get("field")
+		values, err := ix.FacetValues(field)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Field  string                   `json:"field"`
+			Values []searchindex.FacetValue `json:"values"`
+		}{
+			Field:  field,
+			Values: values,
+		})
+	})
 
+	// POST /similar/batch  (body: {"ids": [1, 2], "k": 5})
+	// Nearest neighbours for many products at once, from stored embeddings.
+	mux.HandleFunc("/similar/batch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			IDs []uint `json:"ids"`
+			K   int    `json:"k"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.K <= 0 {
+			req.K = 5
+		}
+		res := ix.SimilarBatch(req.IDs, req.K)
+		for _, rs := range res {
+			roundResults(rs, scorePrecision)
+		}
+		missing := []uint{}
+		for _, id := range req.IDs {
+			if _, ok := res[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Results map[uint][]searchindex.SearchResult `json:"results"`
+			Missing []uint                              `json:"missing"`
+		}{
+			Results: res,
+			Missing: missing,
+		})
+	})
+
+	// POST /compare  (body: {"a": {"query": "...", "flags": {...}},
+	//                        "b": {...}, "topK": 10})
+	// Runs two searches, e.g. one query under two sets of scoring flags
+	// (see experimentFlags), and returns both rankings with a diff. Queries
+	// are searched as given, without rewriting. A side where nothing
+	// scores SEARCH_MIN_CONFIDENCE comes back empty with
+	// noConfidentMatchA or noConfidentMatchB set, as /search does.
+	mux.HandleFunc("/compare", searchLimit.wrap(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			A    compareSide `json:"a"`
+			B    compareSide `json:"b"`
+			TopK int         `json:"topK"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.TopK <= 0 {
+			req.TopK = 10
+		}
 		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
 		defer cancel()
+		var res [2][]searchindex.SearchResult
+		var noConfident [2]bool
+		for i, side := range []compareSide{req.A, req.B} {
+			var err error
+			res[i], err = ix.SearchWithOptions(ctx, side.Query, req.TopK, searchindex.SearchOptions{Flags: side.Flags})
+			switch {
+			case errors.Is(err, searchindex.ErrNoConfidentMatch):
+				res[i], noConfident[i] = []searchindex.SearchResult{}, true
+			case err != nil:
+				http.Error(w, fmt.Sprintf("%s: %v", []string{"a", "b"}[i], err), searchErrorStatus(err))
+				return
+			}
+			roundResults(res[i], scorePrecision)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			A            []searchindex.SearchResult `json:"a"`
+			B            []searchindex.SearchResult `json:"b"`
+			NoConfidentA bool                       `json:"noConfidentMatchA,omitempty"`
+			NoConfidentB bool                       `json:"noConfidentMatchB,omitempty"`
+			Diff         resultDiff                 `json:"diff"`
+		}{
+			A:            res[0],
+			B:            res[1],
+			NoConfidentA: noConfident[0],
+			NoConfidentB: noConfident[1],
+			Diff:         diffResults(res[0], res[1]),
+		})
+	}))
+
+	// GET /search?q=...&topK=10[&context=...][&debug=true][&allAlternatives=true][&explain=true][&envelope=false][&rewrite=false]
+	// rewrite=false skips the LLM rewrite for this request; see
+	// QUERY_REWRITE.
+	// The response is an object wrapping the results; envelope=false, or
+	// an Accept of "application/json; envelope=false", returns the bare
+	// results array instead, without the other fields.
+	// context may be repeated with the session's prior queries or a
+	// selected category, oldest first, to bias ranking towards them once
+	// SEARCH_CONTEXT_WEIGHT is set. Only the last searchContextMax are used.
+	// Results can be filtered with status, category, minPrice, maxPrice,
+	// createdAfter, updatedAfter and minScore; see parseFilter. A filter
+	// nothing passes gives an empty result, not an error.
+	// explain=true adds a plain-English explanation to each result. seed
+	// makes the SEARCH_SHUFFLE_EPSILON shuffle reproducible.
+	// Experiments may add scoring flags and a variant name; see
+	// experimentFlags. sort orders the page by a product field instead of
+	// score, e.g. price or rating_desc. Sorted results aren't paged: they
+	// have no nextCursor, and a cursor with sort is rejected with 400.
+	// The response's nextCursor, passed back as cursor, fetches the next
+	// topK results. Cursors are opaque; one issued before the index last
+	// changed is rejected with 409 Conflict, and paging restarts from the
+	// first page. The bare array of envelope=false has no nextCursor, so
+	// clients that page must use the envelope.
+	mux.HandleFunc("/search", searchLimit.wrap(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		q := r.URL.Query().Get("q")
+		topK := parseIntDefault(r.URL.Query().Get("topK"), 10)
+		if strings.TrimSpace(q) == "" {
+			http.Error(w, "missing q", http.StatusBadRequest)
+			return
+		}
 
-		// 1) Get rewrites from Gemini (spelling fixes, etc.)
-		rw, err := nlp.RewriteQuery(ctx, rewriter, q)
+		debug := r.URL.Query().Get("debug") == "true"
+		allAlts := r.URL.Query().Get("allAlternatives") == "true"
+		sessionCtx := r.URL.Query()["context"]
+		if len(sessionCtx) > searchContextMax {
+			sessionCtx = sessionCtx[len(sessionCtx)-searchContextMax:]
+		}
+		variant, flags := experimentFlags(r)
+		explain := r.URL.Query().Get("explain") == "true"
+		filter, err := parseFilter(r)
 		if err != nil {
-			// On failure, just fall back to the raw query.
-			rw = nlp.Rewrite{Primary: q}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		seed, _ := strconv.ParseUint(r.URL.Query().Get("seed"), 10, 64)
+		rewrite := rewriteDefault
+		if v := r.URL.Query().Get("rewrite"); v != "" {
+			rewrite = v != "false"
+		}
+		sortBy := r.URL.Query().Get("sort")
+		if sortBy != "" {
+			if err := ix.SortBy(nil, sortBy); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		var cursor searchindex.Cursor
+		cursorParam := r.URL.Query().Get("cursor")
+		if cursorParam != "" && sortBy != "" {
+			http.Error(w, searchindex.ErrSortedCursor.Error(), http.StatusBadRequest)
+			return
+		}
+		if cursorParam != "" {
+			if cursor, err = searchindex.ParseCursor(cursorParam); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		opts := searchindex.SearchOptions{Context: sessionCtx, Flags: flags, Explain: explain, Filter: filter, Seed: seed}
+
+		envelope := wantsEnvelope(r)
+		w.Header().Set("Vary", "Accept")
+
+		gen := ix.Generation()
+		if cursorParam != "" && cursor.Generation != gen {
+			http.Error(w, searchindex.ErrStaleCursor.Error(), http.StatusConflict)
+			return
+		}
+		etag := searchETag(q, topK, gen, strconv.FormatBool(debug), strconv.FormatBool(allAlts), strconv.FormatBool(explain), strconv.FormatUint(seed, 10), filterKey(filter), strings.Join(sessionCtx, "\x00"), variant, flagsKey(flags), sortBy, cursorParam, strconv.FormatBool(envelope), strconv.FormatBool(rewrite), ix.ConfigHash())
+		// A seedless shuffle is meant to differ per request, so it is
+		// neither cached nor revalidated.
+		shuffled := seed == 0 && ix.Config().ShuffleEpsilon > 0
+		if !shuffled && etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if e, ok := results.get(etag, gen); ok && !shuffled {
+			ev := e.event
+			ev.Time, ev.TookMs = start, float64(time.Since(start).Microseconds())/1000
+			if onSearch != nil {
+				onSearch(ev)
+			}
+			if !ev.TooGeneric {
+				qlog.record(ev.Rewrite)
+			}
+			if len(ev.IDs) > 0 {
+				ix.RecordQuery(ev.Rewrite)
+			}
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", cacheMaxAge))
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(e.body)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+		defer cancel()
+
+		// Queries of only stop words or punctuation get an empty result
+		// flagged tooGeneric, without calling Gemini at all.
+		tooGeneric := ix.TooGeneric(q)
+
+		// 0) Optionally translate into the catalog language; query is what
+		// gets rewritten and searched from here on.
+		query := q
+		var translation *nlp.Translation
+		if translator != nil && !tooGeneric {
+			if tr, err := translator.Translate(ctx, q); err != nil {
+				log.Printf("translate %q: %v", q, err)
+			} else {
+				translation = &tr
+				query = tr.Translated
+			}
+		}
+
+		// With PRICE_INTENT, a price phrase such as "under 50000" becomes
+		// a price filter and is dropped from the query, so it doesn't
+		// sway the embedding. Explicit minPrice and maxPrice win.
+		var priceIntent *searchindex.PriceRange
+		if priceIntentOn && !tooGeneric {
+			if rest, pr, ok := searchindex.ParsePriceRange(query); ok && strings.TrimSpace(rest) != "" {
+				query, priceIntent = rest, &pr
+				if opts.Filter.MinPrice == nil {
+					opts.Filter.MinPrice = pr.Min
+				}
+				if opts.Filter.MaxPrice == nil {
+					opts.Filter.MaxPrice = pr.Max
+				}
+			}
+		}
+
+		// 1) Get rewrites from Gemini (spelling fixes, etc.). Field hints
+		// such as brand:samsung are held back from the rewriter and local
+		// correction and put back on every query searched.
+		plain, hints := searchindex.SplitHints(query)
+		rw := nlp.Rewrite{Primary: plain}
+		var trace nlp.Trace
+		switch {
+		case !rewrite:
+			trace.Status = nlp.RewriteSkipped
+		case !tooGeneric && plain != "":
+			var err error
+			rw, trace, err = nlp.RewriteQueryTrace(ctx, rewriter, plain, rewriteOpts)
+			if err != nil {
+				// On failure, just fall back to the raw query.
+				log.Printf("rewrite %q: %v", plain, err)
+				rw = nlp.Rewrite{Primary: plain}
+			}
+		}
+		suggested := rw.Primary
+		rw, correction := rw.Gate(plain, rewriteMinConfidence)
+		if localCorrection && !tooGeneric && plain != "" && trace.Status != nlp.RewriteOK {
+			if c, ok := ix.CorrectQuery(rw.Primary); ok {
+				rw.Primary, suggested, correction = c, c, correctionLocal
+			}
+		}
+		if hints != "" {
+			rw.Primary, suggested = searchindex.JoinHints(rw.Primary, hints), searchindex.JoinHints(suggested, hints)
+			for i, alt := range rw.Alternatives {
+				rw.Alternatives[i] = searchindex.JoinHints(alt, hints)
+			}
 		}
 
 		// 2) Search for primary + alternatives and merge by best score
@@ -109,17 +1113,68 @@ func main() {
 			}
 		}
 
-		// primary
-		resPrimary, err := ix.Search(ctx, rw.Primary, topK)
-		if err == nil {
+		// primary: failures here are surfaced, since without it there is
+		// nothing meaningful to return.
+		// Each sub-query fetches topK*fanout candidates so good results
+		// aren't cut before the merge; the merged list is cut to topK.
+		// Later pages need the pages before them too, and one result past
+		// the page tells whether there is a next one.
+		candidates := 0
+		if topK > 0 {
+			candidates = max((cursor.Offset+topK)*fanout, cursor.Offset+topK+1)
+		}
+		var resPrimary []searchindex.SearchResult
+		var noConfident bool
+		if !tooGeneric {
+			var err error
+			resPrimary, err = ix.SearchWithOptions(ctx, rw.Primary, candidates, opts)
+			// Nothing matched well enough: see whether a local spelling
+			// correction does before settling for no results. The
+			// rewriter's alternatives below get their chance too.
+			if errors.Is(err, searchindex.ErrNoConfidentMatch) && localCorrection {
+				primaryPlain, _ := searchindex.SplitHints(rw.Primary)
+				if c, ok := ix.CorrectQuery(primaryPlain); ok {
+					c = searchindex.JoinHints(c, hints)
+					if res, cerr := ix.SearchWithOptions(ctx, c, candidates, opts); cerr == nil {
+						rw.Primary, suggested, correction = c, c, correctionLocal
+						resPrimary, err = res, nil
+					}
+				}
+			}
+			switch {
+			case errors.Is(err, searchindex.ErrTooGeneric):
+				tooGeneric = true
+			case errors.Is(err, searchindex.ErrNoConfidentMatch):
+				noConfident = true
+			case err != nil:
+				log.Printf("search %q: %v", rw.Primary, err)
+				http.Error(w, err.Error(), searchErrorStatus(err))
+				return
+			}
 			merge(resPrimary)
+			// Log the query as embedded, so warmup primes the same cache key.
+			qlog.record(rw.Primary)
 		}
 
-		// alternatives (cap at 2–3 from rewriter)
-		for _, alt := range rw.Alternatives {
-			resAlt, err := ix.Search(ctx, alt, topK)
-			if err == nil {
-				merge(resAlt)
+		// alternatives (cap at 2–3 from rewriter), only when the primary
+		// results are weak: fewer than topK, or a top score below
+		// ALTERNATIVES_MIN_SCORE. allAlternatives=true searches them anyway.
+		searchAlts := allAlts || len(resPrimary) < topK ||
+			(len(resPrimary) > 0 && resPrimary[0].Score < altMinScore)
+		if searchAlts && altMode == "centroid" && len(rw.Alternatives) > 0 {
+			qs := []searchindex.WeightedQuery{{Text: rw.Primary, Weight: 1}}
+			for _, alt := range rw.Alternatives {
+				qs = append(qs, searchindex.WeightedQuery{Text: alt, Weight: altWeight})
+			}
+			if resMulti, err := ix.SearchMultiWithOptions(ctx, qs, candidates, opts); err == nil {
+				merge(resMulti)
+			}
+		} else if searchAlts {
+			for _, alt := range rw.Alternatives {
+				resAlt, err := ix.SearchWithOptions(ctx, alt, candidates, opts)
+				if err == nil {
+					merge(resAlt)
+				}
 			}
 		}
 
@@ -128,27 +1183,337 @@ func main() {
 		for _, v := range best {
 			out = append(out, v)
 		}
-		sort.Slice(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+		searchindex.SortResults(out, ix.Config().Tiebreakers)
+		if len(out) > 0 {
+			ix.RecordQuery(rw.Primary)
+		}
+		if eps := ix.Config().ShuffleEpsilon; eps > 0 {
+			searchindex.ShuffleBands(out, eps, seed)
+		}
+		if cursorParam != "" {
+			if out, err = searchindex.Resume(out, cursor, q, gen); err != nil {
+				http.Error(w, err.Error(), searchErrorStatus(err))
+				return
+			}
+		}
+		var next string
 		if topK > 0 && topK < len(out) {
 			out = out[:topK]
+			if sortBy == "" {
+				next = searchindex.NextCursor(q, gen, cursor.Offset, out).String()
+			}
+		}
+		if sortBy != "" {
+			_ = ix.SortBy(out, sortBy) // checked above
 		}
 
+		ev := searchEvent{Time: start, Query: q, Rewrite: rw.Primary, Variant: variant, TooGeneric: tooGeneric,
+			IDs: make([]uint, len(out)), Scores: make([]float64, len(out)),
+			TookMs: float64(time.Since(start).Microseconds()) / 1000}
+		for i, res := range out {
+			ev.IDs[i], ev.Scores[i] = res.Product.ID, res.Score
+		}
+		if onSearch != nil {
+			onSearch(ev)
+		}
+
+		var relaxed []string
+		if len(resPrimary) > 0 {
+			relaxed = resPrimary[0].Relaxed
+		}
+		partial := slices.ContainsFunc(out, func(r searchindex.SearchResult) bool { return r.Partial })
+		if partial {
+			next = ""
+		}
+		roundResults(out, scorePrecision)
+
+		// Only successful, complete, reproducible responses are cacheable.
+		switch {
+		case shuffled:
+			w.Header().Set("Cache-Control", "no-store")
+		case !partial:
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", cacheMaxAge))
+		}
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(struct {
-			Query      string                     `json:"query"`
-			Normalized nlp.Rewrite                `json:"normalized"`
-			Results    []searchindex.SearchResult `json:"results"`
-		}{
-			Query:      q,
-			Normalized: rw,
-			Results:    out,
-		})
-	})
+		var dbg *searchDebug
+		if debug {
+			dbg = &searchDebug{Rewriter: trace, Correction: correction, Suggested: suggested, AlternativesSearched: searchAlts && len(rw.Alternatives) > 0}
+			if cat, ok := searchindex.BoostedCategory(resPrimary); ok {
+				dbg.InferredCategory = cat
+			}
+		}
+		// generation is the index generation the response was built at. It
+		// only ever increases within a process, so a higher value than a
+		// cached response's means the index has changed since. It restarts
+		// from zero when the process does. model names the embedding model
+		// and vector size behind the scores. relaxed lists the filters
+		// dropped to reach SEARCH_MIN_RESULTS. partial is set when the
+		// search ran short of time; see SEARCH_PARTIAL_MARGIN. priceIntent
+		// is the price phrase read from the query; see PRICE_INTENT.
+		// noConfidentMatch means nothing scored SEARCH_MIN_CONFIDENCE.
+		// nextCursor fetches the next page; it is left out on the last
+		// page, on partial ones and on sorted ones.
+		// smallCorpus warns that the index is below SMALL_CORPUS_SIZE, so
+		// scores say little about relevance.
+		var body bytes.Buffer
+		if envelope {
+			_ = json.NewEncoder(&body).Encode(struct {
+				Query       string                     `json:"query"`
+				Translation *nlp.Translation           `json:"translation,omitempty"`
+				Normalized  nlp.Rewrite                `json:"normalized"`
+				Results     []searchindex.SearchResult `json:"results"`
+				Generation  uint64                     `json:"generation"`
+				Model       searchindex.ModelInfo      `json:"model"`
+				TooGeneric  bool                       `json:"tooGeneric,omitempty"`
+				Relaxed     []string                   `json:"relaxed,omitempty"`
+				Partial     bool                       `json:"partial,omitempty"`
+				NoConfident bool                       `json:"noConfidentMatch,omitempty"`
+				SmallCorpus bool                       `json:"smallCorpus,omitempty"`
+				PriceIntent *searchindex.PriceRange    `json:"priceIntent,omitempty"`
+				NextCursor  string                     `json:"nextCursor,omitempty"`
+				Variant     string                     `json:"variant,omitempty"`
+				Debug       *searchDebug               `json:"debug,omitempty"`
+			}{
+				Query:       q,
+				Translation: translation,
+				Normalized:  capAlternatives(rw, responseMaxAlts),
+				Results:     out,
+				Generation:  gen,
+				Model:       ix.ModelInfo(),
+				TooGeneric:  tooGeneric,
+				Relaxed:     relaxed,
+				Partial:     partial,
+				NoConfident: noConfident && len(out) == 0,
+				SmallCorpus: ix.SmallCorpus(),
+				PriceIntent: priceIntent,
+				NextCursor:  next,
+				Variant:     variant,
+				Debug:       dbg,
+			})
+		} else {
+			_ = json.NewEncoder(&body).Encode(out)
+		}
+		_, _ = w.Write(body.Bytes())
+		if !partial && !shuffled {
+			results.put(etag, gen, body.Bytes(), ev)
+		}
+	}))
 
 	addr := getenvDefault("ADDR", ":8080")
 	log.Printf("fuzzy-search service listening on %s (model=%s, sem=%.2f, fuzzy=%.2f)",
 		addr, modelName, semW, fuzW)
-	log.Fatal(http.ListenAndServe(addr, mux))
+	log.Fatal(newHTTPServer(addr, mux).ListenAndServe())
+}
+
+// searchContextMax caps how many /search context entries are embedded.
+const searchContextMax = 5
+
+// wantsEnvelope reports whether a /search response should be the wrapped
+// object rather than the bare results array: the envelope parameter
+// decides if given, then an envelope parameter on an application/json
+// Accept type.
+func wantsEnvelope(r *http.Request) bool {
+	if v := r.URL.Query().Get("envelope"); v != "" {
+		return v != "false"
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mt == "application/json" && params["envelope"] == "false" {
+			return false
+		}
+	}
+	return true
+}
+
+// experimentFlags reads the experiment variant and its scoring flags from a
+// /search request: the variant from the X-Search-Variant header or variant
+// parameter, and flags from the X-Search-Flags header ("blend=rrf,
+// brandBoost=0") and flag.<name>=value parameters, parameters winning. Flag
+// names are searchindex.FlagBlend and friends; the index ignores any it
+// doesn't know.
+func experimentFlags(r *http.Request) (variant string, flags map[string]string) {
+	variant = r.URL.Query().Get("variant")
+	if variant == "" {
+		variant = r.Header.Get("X-Search-Variant")
+	}
+	for _, kv := range strings.Split(r.Header.Get("X-Search-Flags"), ",") {
+		if name, v, ok := strings.Cut(strings.TrimSpace(kv), "="); ok {
+			if flags == nil {
+				flags = map[string]string{}
+			}
+			flags[strings.TrimSpace(name)] = strings.TrimSpace(v)
+		}
+	}
+	for k, vs := range r.URL.Query() {
+		if name, ok := strings.CutPrefix(k, "flag."); ok && len(vs) > 0 {
+			if flags == nil {
+				flags = map[string]string{}
+			}
+			flags[name] = vs[0]
+		}
+	}
+	return variant, flags
+}
+
+// flagsKey is flags in a stable form for the ETag.
+func flagsKey(flags map[string]string) string {
+	kv := make([]string, 0, len(flags))
+	for k, v := range flags {
+		kv = append(kv, k+"="+v)
+	}
+	sort.Strings(kv)
+	return strings.Join(kv, ",")
+}
+
+// reindexBuilder starts a build with the embedding batch size from the
+// batchSize parameter, when given.
+func reindexBuilder(ix *searchindex.Index, r *http.Request) (*searchindex.Builder, error) {
+	b := ix.NewBuilder()
+	if v := r.URL.Query().Get("batchSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.New("invalid batchSize")
+		}
+		if err := b.SetBatchSize(n); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// requestProductID reads the product from an id parameter, or an
+// externalId parameter for catalogs keyed by strings. An unknown externalId
+// maps to 0, which is never indexed.
+func requestProductID(r *http.Request, ix *searchindex.Index) (uint, error) {
+	if ext := r.URL.Query().Get("externalId"); ext != "" {
+		id, _ := ix.IDFor(ext)
+		return id, nil
+	}
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 0)
+	if err != nil {
+		return 0, errors.New("invalid id")
+	}
+	return uint(id), nil
+}
+
+// parseFilter reads searchindex.Filter from request parameters: status and
+// category may be repeated, minPrice, maxPrice and minScore are numbers, and
+// createdAfter and updatedAfter are RFC 3339 times or durations back from
+// now ("168h" for the last week).
+func parseFilter(r *http.Request) (searchindex.Filter, error) {
+	var f searchindex.Filter
+	qv := r.URL.Query()
+	for _, s := range qv["status"] {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return f, fmt.Errorf("invalid status %q", s)
+		}
+		f.Statuses = append(f.Statuses, n)
+	}
+	for _, s := range qv["category"] {
+		n, err := strconv.ParseUint(s, 10, 0)
+		if err != nil {
+			return f, fmt.Errorf("invalid category %q", s)
+		}
+		f.CategoryIDs = append(f.CategoryIDs, uint(n))
+	}
+	for name, dst := range map[string]**float64{"minPrice": &f.MinPrice, "maxPrice": &f.MaxPrice} {
+		if s := qv.Get(name); s != "" {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s %q", name, s)
+			}
+			*dst = &v
+		}
+	}
+	for name, dst := range map[string]*time.Time{"createdAfter": &f.CreatedAfter, "updatedAfter": &f.UpdatedAfter} {
+		if s := qv.Get(name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				d, derr := time.ParseDuration(s)
+				if derr != nil {
+					return f, fmt.Errorf("invalid %s %q", name, s)
+				}
+				t = time.Now().Add(-d)
+			}
+			*dst = t
+		}
+	}
+	if s := qv.Get("minScore"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid minScore %q", s)
+		}
+		f.MinScore = v
+	}
+	return f, nil
+}
+
+// filterKey is f in a stable form for the ETag.
+func filterKey(f searchindex.Filter) string {
+	b, _ := json.Marshal(f)
+	return string(b)
+}
+
+// capAlternatives returns rw with at most n alternatives; n < 0 keeps all.
+func capAlternatives(rw nlp.Rewrite, n int) nlp.Rewrite {
+	if n >= 0 && len(rw.Alternatives) > n {
+		rw.Alternatives = rw.Alternatives[:n:n]
+	}
+	return rw
+}
+
+// roundResults rounds the scores of rs in place for the response; see
+// SCORE_PRECISION.
+func roundResults(rs []searchindex.SearchResult, digits int) {
+	for i := range rs {
+		rs[i] = rs[i].Rounded(digits)
+	}
+}
+
+// searchErrorStatus maps a search failure to the HTTP status reported to
+// clients: bad input is the caller's fault, an empty index means the service
+// isn't ready yet, and embedding failures come from Gemini upstream.
+func searchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, searchindex.ErrEmptyQuery), errors.Is(err, nlp.ErrEmptyQuery),
+		errors.Is(err, searchindex.ErrTooGeneric), errors.Is(err, searchindex.ErrUnknownSortField):
+		return http.StatusBadRequest
+	case errors.Is(err, searchindex.ErrBadCursor), errors.Is(err, searchindex.ErrSortedCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, searchindex.ErrStaleCursor):
+		return http.StatusConflict
+	case errors.Is(err, searchindex.ErrIndexEmpty):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, searchindex.ErrEmbedding), errors.Is(err, nlp.ErrGeneration):
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// envWeights reads signal weights such as "semantic=0.6,fuzzy=0.4" from
+// env var k, exiting on a weight that doesn't parse.
+func envWeights(k string) map[string]float64 {
+	var out map[string]float64
+	for _, kv := range strings.Split(os.Getenv(k), ",") {
+		name, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			continue
+		}
+		w, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Fatalf("%s: %s: %v", k, name, err)
+		}
+		if out == nil {
+			out = map[string]float64{}
+		}
+		out[name] = w
+	}
+	return out
 }
 
 func getenvDefault(k, def string) string {
@@ -175,14 +1540,71 @@ func parseFloatDefault(s string, def float64) float64 {
 	}
 	return def
 }
+func parseDurationDefault(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d
+	}
+	return def
+}
+
+// searchDebug is the /search?debug=true section of the response.
+type searchDebug struct {
+	Rewriter nlp.Trace `json:"rewriter"`
+	// Correction is whether the rewriter's Primary was used (see
+	// nlp.Rewrite.Gate) or correctionLocal, and Suggested is what was
+	// proposed. Rewriter.Status says whether the rewriter ran at all.
+	Correction string `json:"correction"`
+	Suggested  string `json:"suggested"`
+	// AlternativesSearched is false when strong primary results made
+	// searching the rewriter's alternatives unnecessary.
+	AlternativesSearched bool `json:"alternativesSearched"`
+	// InferredCategory is the category CATEGORY_BOOST favoured, if any.
+	InferredCategory uint `json:"inferredCategory,omitempty"`
+}
+
+// correctionLocal is searchDebug.Correction when the query was corrected
+// locally because the rewriter didn't produce a usable rewrite.
+const correctionLocal = "local"
+
+// searchETag identifies a /search response by the normalized query, topK and
+// index generation, so a reindex naturally invalidates cached responses.
+// extra holds any other request options that change the response.
+func searchETag(q string, topK int, gen uint64, extra ...string) string {
+	norm := strings.ToLower(strings.Join(strings.Fields(q), " "))
+	key := fmt.Sprintf("%s\x00%d\x00%d", norm, topK, gen)
+	for _, e := range extra {
+		key += "\x00" + e
+	}
+	sum := sha256.Sum256([]byte(key))
+	return fmt.Sprintf(`"%x"`, sum[:16])
+}
+
+// etagMatches reports whether an If-None-Match header matches etag.
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+	return false
+}
 
 func toIndexProducts(ps []models.Product) []searchindex.Product {
 	out := make([]searchindex.Product, 0, len(ps))
 	for _, p := range ps {
+		var variants []searchindex.Variant
+		for _, v := range p.Variants {
+			variants = append(variants, searchindex.Variant{SKU: v.SKU, Attributes: v.Attributes})
+		}
 		out = append(out, searchindex.Product{
-			ID: p.ID, SellerID: p.SellerID, CategoryID: p.CategoryID,
+			ID: p.ID, ExternalID: p.ExternalID, SellerID: p.SellerID, CategoryID: p.CategoryID,
 			Title: p.Title, Description: p.Description, Brand: p.Brand,
-			Status: p.Status, Score: p.Score,
+			Status: p.Status, Score: p.Score, Variants: variants, ImageURL: p.ImageURL,
+			Price: p.Price, CreatedAt: p.CreatedAt, UpdatedAt: p.UpdatedAt,
 		})
 	}
 	return out
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"gocom_fuzzy_search/searchindex"
+)
+
+// metrics holds process-wide counters exposed at /metrics in the Prometheus
+// text format. Fields are updated atomically on the request path.
+type metrics struct {
+	ix        *searchindex.Index
+	analytics *analyticsSink
+	results   *resultCache
+
+	searchInflight atomic.Int64
+	searchRejected atomic.Int64
+}
+
+func (m *metrics) handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetric(w, "search_inflight", "gauge", "Searches currently being served.", m.searchInflight.Load())
+	writeMetric(w, "search_rejected_total", "counter", "Searches rejected by the concurrency limit.", m.searchRejected.Load())
+	writeMetric(w, "analytics_dropped_total", "counter", "Search analytics events dropped because the queue was full.", m.analytics.Dropped())
+
+	cs := m.ix.QueryCacheStats()
+	writeMetric(w, "query_cache_entries", "gauge", "Query embeddings cached.", cs.Entries)
+	writeMetric(w, "query_cache_bytes", "gauge", "Approximate memory held by the query embedding cache.", cs.Bytes)
+	writeMetric(w, "query_cache_max_bytes", "gauge", "Memory budget of the query embedding cache.", cs.MaxBytes)
+	writeMetric(w, "query_cache_hits_total", "counter", "Query embeddings served from the cache.", cs.Hits)
+	writeMetric(w, "query_cache_misses_total", "counter", "Query embeddings not found in the cache.", cs.Misses)
+
+	rs := m.results.stats()
+	writeMetric(w, "result_cache_entries", "gauge", "Search responses cached.", rs.Entries)
+	writeMetric(w, "result_cache_bytes", "gauge", "Approximate memory held by the result cache.", rs.Bytes)
+	writeMetric(w, "result_cache_max_bytes", "gauge", "Memory budget of the result cache.", rs.MaxBytes)
+	writeMetric(w, "result_cache_hits_total", "counter", "Search responses served from the result cache.", rs.Hits)
+	writeMetric(w, "result_cache_misses_total", "counter", "Searches not found in the result cache.", rs.Misses)
+	writeMetric(w, "result_cache_evictions_total", "counter", "Result cache entries evicted to stay within budget.", rs.Evictions)
+	writeMetric(w, "result_cache_expirations_total", "counter", "Result cache entries dropped after RESULT_CACHE_TTL.", rs.Expirations)
+	writeMetric(w, "result_cache_invalidations_total", "counter", "Result cache entries dropped because the index changed.", rs.Invalidated)
+
+	ts := m.ix.TokenStats()
+	writeMetric(w, "embedding_tokens_total", "counter", "Approximate tokens sent to the embedding API (chars/4).", ts.Search+ts.Index)
+	writeMetric(w, "embedding_tokens_search_total", "counter", "Approximate embedding tokens for search queries.", ts.Search)
+	writeMetric(w, "embedding_tokens_index_total", "counter", "Approximate embedding tokens for indexing products.", ts.Index)
+	writeMetric(w, "embedding_calls_search_total", "counter", "Embedding API calls for search queries.", ts.SearchCalls)
+	writeMetric(w, "embedding_calls_index_total", "counter", "Embedding API calls for indexing products, a batch counting once.", ts.IndexCalls)
+}
+
+func writeMetric(w http.ResponseWriter, name, kind, help string, v any) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, v)
+}
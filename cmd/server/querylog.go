@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gocom_fuzzy_search/searchindex"
+)
+
+// queryLog appends a sample of searched queries to a file, one per line,
+// so popular queries can be replayed at startup. When the file grows past
+// maxBytes it is renamed to path+".1" (replacing the previous one) and a
+// new file is started.
+type queryLog struct {
+	path     string
+	sample   float64
+	maxBytes int64
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openQueryLog(path string, sample float64, maxBytes int64) (*queryLog, error) {
+	l := &queryLog{path: path, sample: sample, maxBytes: maxBytes}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *queryLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size = f, fi.Size()
+	return nil
+}
+
+// record logs q with probability l.sample. Failures are logged, never
+// returned, so they can't affect the search being served.
+func (l *queryLog) record(q string) {
+	if l == nil || rand.Float64() >= l.sample {
+		return
+	}
+	q = strings.Join(strings.Fields(q), " ")
+	if q == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxBytes > 0 && l.size >= l.maxBytes {
+		l.f.Close()
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			log.Printf("query log: rotate: %v", err)
+		}
+		if err := l.open(); err != nil {
+			log.Printf("query log: %v", err)
+			return
+		}
+	}
+	n, err := l.f.WriteString(q + "\n")
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("query log: %v", err)
+	}
+}
+
+// topQueries returns the n most frequent queries in the query log at path
+// and its rotated predecessor, most frequent first.
+func topQueries(path string, n int) ([]string, error) {
+	counts := map[string]int{}
+	for _, p := range []string{path + ".1", path} {
+		f, err := os.Open(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if q := sc.Text(); q != "" {
+				counts[q]++
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+	qs := make([]string, 0, len(counts))
+	for q := range counts {
+		qs = append(qs, q)
+	}
+	sort.Slice(qs, func(i, j int) bool {
+		if counts[qs[i]] != counts[qs[j]] {
+			return counts[qs[i]] > counts[qs[j]]
+		}
+		return qs[i] < qs[j]
+	})
+	if len(qs) > n {
+		qs = qs[:n]
+	}
+	return qs, nil
+}
+
+// warmEmbeddingsFromQueryLog primes the query embedding cache, and only
+// that, with the n most frequent logged queries.
+func warmEmbeddingsFromQueryLog(ctx context.Context, ix *searchindex.Index, path string, n int) {
+	qs, err := topQueries(path, n)
+	if err != nil {
+		log.Printf("query embedding warmup: %v", err)
+		return
+	}
+	start := time.Now()
+	warmed, err := ix.WarmQueryCache(ctx, qs)
+	if err != nil {
+		log.Printf("query embedding warmup: %v", err)
+	}
+	log.Printf("query embedding warmup: embedded %d of %d popular queries in %s", warmed, len(qs), time.Since(start).Round(time.Millisecond))
+}
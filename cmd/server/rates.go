@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// loadIDMap reads a JSON object of ID to value, e.g. product ID to
+// engagement rate as exported from search analytics:
+// {"1": 0.12, "2": 0.03}.
+func loadIDMap(path string) (map[uint]float64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m map[uint]float64
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// idMapLoop reloads the ID map at path into apply every interval until
+// ctx is done, skipping reloads when the file hasn't changed. A failed
+// read keeps the map already applied. name labels the log lines.
+func idMapLoop(ctx context.Context, name, path string, interval time.Duration, apply func(map[uint]float64)) {
+	var loaded time.Time
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if fi, err := os.Stat(path); err != nil {
+			log.Printf("%s: %v", name, err)
+		} else if !fi.ModTime().Equal(loaded) {
+			if m, err := loadIDMap(path); err != nil {
+				log.Printf("%s: %v", name, err)
+			} else {
+				apply(m)
+				loaded = fi.ModTime()
+				log.Printf("%s: loaded %d from %s", name, len(m), path)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gocom_fuzzy_search/searchindex"
+)
+
+// loadConfigFile overlays the JSON file at path onto a copy of base. Keys
+// missing from the file keep base's value, and unknown keys are rejected so
+// typos don't silently do nothing. base itself is never modified, so a key
+// dropped from the file reverts on the next load.
+func loadConfigFile(path string, base searchindex.Config) (searchindex.Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return base, err
+	}
+	cfg := base.Clone()
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return base, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return base, fmt.Errorf("validate %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// watchConfig polls path every interval and applies it to ix whenever its
+// modification time changes. An invalid file is logged and ignored, leaving
+// the previous config active.
+func watchConfig(ctx context.Context, path string, interval time.Duration, base searchindex.Config, ix *searchindex.Index) {
+	var last time.Time
+	if fi, err := os.Stat(path); err == nil {
+		last = fi.ModTime()
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.Printf("config reload: %v", err)
+			continue
+		}
+		if !fi.ModTime().After(last) {
+			continue
+		}
+		last = fi.ModTime()
+		cfg, err := loadConfigFile(path, base)
+		if err == nil {
+			err = ix.SetConfig(cfg)
+		}
+		if err != nil {
+			log.Printf("config reload rejected, keeping previous config: %v", err)
+			continue
+		}
+		log.Printf("config reloaded from %s", path)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Eviction policies accepted by RESULT_CACHE_POLICY.
+const (
+	evictLRU = "lru" // least recently used goes first
+	evictLFU = "lfu" // least often used goes first; ties by recency
+)
+
+// resultCacheOverhead approximates the per-entry bookkeeping on top of the
+// key and body bytes.
+const resultCacheOverhead = 256
+
+// resultCache keeps encoded /search responses keyed by ETag, so repeated
+// queries skip the rewriter and the embedding API altogether. It is
+// bounded by approximate memory, like the query embedding cache, but kept
+// separate from it: a response is worth far less than the embedding behind
+// it. Entries expire after ttl and all of them are dropped as soon as the
+// index generation moves, whatever their age. A nil *resultCache caches
+// nothing.
+type resultCache struct {
+	maxBytes int64
+	ttl      time.Duration // 0 never expires
+	policy   string
+
+	mu    sync.Mutex
+	gen   uint64
+	ll    *list.List // front = most recently used
+	items map[string]*list.Element
+	bytes int64
+
+	hits, misses, evictions, expirations, invalidations uint64
+}
+
+type resultEntry struct {
+	key    string
+	body   []byte
+	event  searchEvent // replayed to analytics on a hit
+	stored time.Time
+	uses   uint64
+}
+
+func (e *resultEntry) size() int64 {
+	return int64(len(e.key)+len(e.body)) + resultCacheOverhead
+}
+
+// newResultCache returns a cache of at most maxBytes, or nil when maxBytes
+// is 0.
+func newResultCache(maxBytes int64, ttl time.Duration, policy string) (*resultCache, error) {
+	if policy != evictLRU && policy != evictLFU {
+		return nil, fmt.Errorf("unknown eviction policy %q (want %s or %s)", policy, evictLRU, evictLFU)
+	}
+	if maxBytes <= 0 {
+		return nil, nil
+	}
+	return &resultCache{maxBytes: maxBytes, ttl: ttl, policy: policy, ll: list.New(), items: map[string]*list.Element{}}, nil
+}
+
+// get returns the entry for key if it was stored at index generation gen
+// and hasn't expired.
+func (c *resultCache) get(key string, gen uint64) (*resultEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sync(gen)
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	e := el.Value.(*resultEntry)
+	if c.ttl > 0 && time.Since(e.stored) > c.ttl {
+		c.remove(el)
+		c.expirations++
+		c.misses++
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	e.uses++
+	c.hits++
+	return e, true
+}
+
+// put stores a response built at generation gen and evicts by the policy
+// until the cache fits. Responses larger than the whole budget are not
+// stored.
+func (c *resultCache) put(key string, gen uint64, body []byte, ev searchEvent) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sync(gen)
+	if gen != c.gen {
+		return // built before a reindex that has since landed
+	}
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	e := &resultEntry{key: key, body: body, event: ev, stored: time.Now(), uses: 1}
+	if e.size() > c.maxBytes {
+		return
+	}
+	for c.bytes+e.size() > c.maxBytes {
+		c.remove(c.victim())
+		c.evictions++
+	}
+	c.items[key] = c.ll.PushFront(e)
+	c.bytes += e.size()
+}
+
+// sync drops every entry once the index has moved past the generation
+// they were built at; the caller holds c.mu.
+func (c *resultCache) sync(gen uint64) {
+	if gen <= c.gen {
+		return
+	}
+	c.invalidations += uint64(len(c.items))
+	c.gen = gen
+	c.ll.Init()
+	clear(c.items)
+	c.bytes = 0
+}
+
+// victim picks the entry to evict: the least recently used one, or with
+// evictLFU the least used one, scanning from the least recent end so ties
+// go to the oldest. The scan is linear in the number of entries.
+func (c *resultCache) victim() *list.Element {
+	worst := c.ll.Back()
+	if c.policy != evictLFU {
+		return worst
+	}
+	for el := worst.Prev(); el != nil; el = el.Prev() {
+		if el.Value.(*resultEntry).uses < worst.Value.(*resultEntry).uses {
+			worst = el
+		}
+	}
+	return worst
+}
+
+// remove drops el; the caller holds c.mu.
+func (c *resultCache) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*resultEntry)
+	delete(c.items, e.key)
+	c.bytes -= e.size()
+}
+
+// resultCacheStats is a snapshot of the cache for /metrics.
+type resultCacheStats struct {
+	Entries                                           int
+	Bytes, MaxBytes                                   int64
+	Hits, Misses, Evictions, Expirations, Invalidated uint64
+}
+
+func (c *resultCache) stats() resultCacheStats {
+	if c == nil {
+		return resultCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return resultCacheStats{
+		Entries: len(c.items), Bytes: c.bytes, MaxBytes: c.maxBytes,
+		Hits: c.hits, Misses: c.misses, Evictions: c.evictions,
+		Expirations: c.expirations, Invalidated: c.invalidations,
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"time"
+)
+
+// newHTTPServer builds the server for the API. Unlike http.ListenAndServe
+// it bounds how long a client may take, so slow or stalled connections
+// can't pile up:
+//
+//	HTTP_READ_HEADER_TIMEOUT  time to send request headers (default 5s)
+//	HTTP_READ_TIMEOUT         time to send the whole request (default 30s)
+//	HTTP_WRITE_TIMEOUT        time from end of headers to end of response (default 90s)
+//	HTTP_IDLE_TIMEOUT         how long keep-alive connections wait for the next request (default 120s)
+//
+// Durations use Go syntax ("30s", "2m"); 0 disables a limit. The write
+// timeout must cover a full /reindex, whose embedding stage alone may take
+// 60s. /reindex/stream lifts both read and write deadlines itself.
+func newHTTPServer(addr string, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: parseDurationDefault(os.Getenv("HTTP_READ_HEADER_TIMEOUT"), 5*time.Second),
+		ReadTimeout:       parseDurationDefault(os.Getenv("HTTP_READ_TIMEOUT"), 30*time.Second),
+		WriteTimeout:      parseDurationDefault(os.Getenv("HTTP_WRITE_TIMEOUT"), 90*time.Second),
+		IdleTimeout:       parseDurationDefault(os.Getenv("HTTP_IDLE_TIMEOUT"), 120*time.Second),
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gocom_fuzzy_search/searchindex"
+)
+
+// snapshotCodec maps INDEX_SNAPSHOT_FORMAT to a codec.
+func snapshotCodec(format string) (searchindex.IndexCodec, error) {
+	switch format {
+	case "", "gob":
+		return searchindex.GobCodec{}, nil
+	case "json":
+		return searchindex.JSONCodec{}, nil
+	}
+	return nil, fmt.Errorf("unknown snapshot format %q (want gob or json)", format)
+}
+
+// loadSnapshot restores ix from path if the file exists.
+func loadSnapshot(ix *searchindex.Index, path string, codec searchindex.IndexCodec) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := ix.Load(f, codec); err != nil {
+		return err
+	}
+	log.Printf("loaded %d products from snapshot %s", ix.Len(), path)
+	return nil
+}
+
+// saveSnapshot writes ix to path via a temporary file, so a crash never
+// leaves a half-written snapshot behind. Failures are logged: the index
+// itself is fine, only the next restart will need a reindex.
+func saveSnapshot(ix *searchindex.Index, path string, codec searchindex.IndexCodec) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		log.Printf("save snapshot: %v", err)
+		return
+	}
+	err = ix.Save(tmp, codec)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("save snapshot: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"gocom_fuzzy_search/models"
+	"gocom_fuzzy_search/searchindex"
+)
+
+// fileLoader is a searchindex.Loader over a JSON array of products in a
+// file, standing in for the marketplace database until it is wired up.
+// Products keyed by ExternalID are reported under the internal IDs ix
+// assigned them.
+type fileLoader struct {
+	path string
+	ix   *searchindex.Index
+}
+
+// id returns p's ID in the index, and false for a product keyed by an
+// ExternalID the index hasn't assigned an ID yet.
+func (l fileLoader) id(p models.Product) (uint, bool) {
+	if p.ID != 0 || p.ExternalID == "" {
+		return p.ID, true
+	}
+	return l.ix.IDFor(p.ExternalID)
+}
+
+func (l fileLoader) read() ([]models.Product, error) {
+	b, err := os.ReadFile(l.path)
+	if err != nil {
+		return nil, err
+	}
+	var ps []models.Product
+	if err := json.Unmarshal(b, &ps); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+func (l fileLoader) ChangedSince(_ context.Context, since time.Time) ([]searchindex.Product, error) {
+	ps, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+	var changed []models.Product
+	for _, p := range ps {
+		if since.IsZero() || p.UpdatedAt.After(since) {
+			changed = append(changed, p)
+		}
+	}
+	return toIndexProducts(changed), nil
+}
+
+func (l fileLoader) IDs(context.Context) ([]uint, error) {
+	ps, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(ps))
+	for _, p := range ps {
+		if id, ok := l.id(p); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (l fileLoader) Product(_ context.Context, id uint) (searchindex.Product, bool, error) {
+	ps, err := l.read()
+	if err != nil {
+		return searchindex.Product{}, false, err
+	}
+	for _, p := range ps {
+		if pid, ok := l.id(p); ok && pid == id {
+			return toIndexProducts([]models.Product{p})[0], true, nil
+		}
+	}
+	return searchindex.Product{}, false, nil
+}
+
+// syncLoop syncs ix from loader every interval until ctx is done, calling
+// after when anything changed.
+func syncLoop(ctx context.Context, ix *searchindex.Index, loader searchindex.Loader, interval time.Duration, after func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		sum, err := ix.Sync(ctx, loader)
+		if err != nil {
+			log.Printf("sync: %v", err)
+			continue
+		}
+		if sum.Added+sum.Updated+sum.Deleted > 0 {
+			log.Printf("sync: %d added, %d updated, %d deleted (since %s)",
+				sum.Added, sum.Updated, sum.Deleted, sum.Since.Format(time.RFC3339))
+			after()
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"time"
+)
+
+// genaiHTTPClient builds the HTTP client used for Gemini calls. Go's default
+// transport keeps only 2 idle connections per host, which caps throughput
+// under concurrent search load, so the limits are raised and tunable:
+//
+//	GENAI_MAX_IDLE_CONNS           idle connections overall (default 100)
+//	GENAI_MAX_IDLE_CONNS_PER_HOST  idle connections to Gemini (default 32)
+//	GENAI_MAX_CONNS_PER_HOST       concurrent connections, 0 = unlimited (default 0)
+//	GENAI_IDLE_CONN_TIMEOUT_SECONDS how long idle connections are kept (default 90)
+//	GENAI_HTTP_TIMEOUT_SECONDS     whole-request timeout, 0 = rely on the request context (default 0)
+func genaiHTTPClient() *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = parseIntDefault(os.Getenv("GENAI_MAX_IDLE_CONNS"), 100)
+	t.MaxIdleConnsPerHost = parseIntDefault(os.Getenv("GENAI_MAX_IDLE_CONNS_PER_HOST"), 32)
+	t.MaxConnsPerHost = parseIntDefault(os.Getenv("GENAI_MAX_CONNS_PER_HOST"), 0)
+	t.IdleConnTimeout = time.Duration(parseIntDefault(os.Getenv("GENAI_IDLE_CONN_TIMEOUT_SECONDS"), 90)) * time.Second
+	return &http.Client{
+		Transport: t,
+		Timeout:   time.Duration(parseIntDefault(os.Getenv("GENAI_HTTP_TIMEOUT_SECONDS"), 0)) * time.Second,
+	}
+}
+
+// apiKeyTransport adds the Gemini API key to every request. The legacy SDK
+// ignores option.WithAPIKey once a custom HTTP client is supplied.
+type apiKeyTransport struct {
+	key  string
+	base http.RoundTripper
+}
+
+func (t apiKeyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("x-goog-api-key", t.key)
+	return t.base.RoundTrip(r)
+}
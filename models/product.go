@@ -4,6 +4,7 @@ import "time"
 
 type Product struct {
 	ID          uint
+	ExternalID  string // for catalogs keyed by strings; leave ID 0
 	SellerID    uint
 	CategoryID  uint
 	Title       string
@@ -11,6 +12,16 @@ type Product struct {
 	Brand       string
 	Status      int
 	Score       int
+	Variants    []Variant
+	ImageURL    string
+	Price       float64
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
+
+// Variant is one purchasable version of a product, e.g. a colour/storage
+// combination, identified by its SKU.
+type Variant struct {
+	SKU        string
+	Attributes map[string]string // e.g. {"color": "black", "storage": "256GB"}
+}
@@ -0,0 +1,10 @@
+package nlp
+
+import "errors"
+
+var (
+	// ErrEmptyQuery is returned when the query to rewrite is blank.
+	ErrEmptyQuery = errors.New("nlp: empty query")
+	// ErrGeneration wraps failures from the underlying LLM call.
+	ErrGeneration = errors.New("nlp: generation failed")
+)
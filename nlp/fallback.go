@@ -0,0 +1,53 @@
+package nlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+	unified "google.golang.org/genai"
+)
+
+// FallbackGenerator tries each Generator in order, e.g. the same prompt on
+// progressively cheaper models. It moves to the next one only when a call
+// fails with a retryable error (rate limit, overload, server error) and the
+// context is still live; any other error is returned straight away.
+type FallbackGenerator []Generator
+
+func (f FallbackGenerator) Generate(ctx context.Context, req GenerateRequest) (string, error) {
+	var errs []error
+	for i, g := range f {
+		txt, err := g.Generate(ctx, req)
+		if err == nil {
+			return txt, nil
+		}
+		errs = append(errs, fmt.Errorf("generator %d: %w", i, err))
+		if ctx.Err() != nil || !retryable(err) {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return "", errors.New("no generators configured")
+	}
+	return "", errors.Join(errs...)
+}
+
+// retryable reports whether err is an HTTP status worth trying another
+// model for: 429 (quota) or 5xx.
+func retryable(err error) bool {
+	code := 0
+	var apiErr unified.APIError
+	var legacyErr interface{ HTTPCode() int }
+	var gErr *googleapi.Error
+	switch {
+	case errors.As(err, &apiErr):
+		code = apiErr.Code
+	case errors.As(err, &gErr):
+		code = gErr.Code
+	case errors.As(err, &legacyErr):
+		code = legacyErr.HTTPCode()
+	}
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
@@ -0,0 +1,165 @@
+package nlp
+
+import (
+	"context"
+
+	genai "github.com/google/generative-ai-go/genai"
+	unified "google.golang.org/genai"
+)
+
+// GenerateRequest is a single prompt sent to a Generator.
+type GenerateRequest struct {
+	// Parts are sent in order as text parts of one user turn.
+	Parts []string
+	// ResponseMIMEType, e.g. "application/json", asks the model for that
+	// output format. Empty leaves the model's default (plain text).
+	ResponseMIMEType string
+	// ResponseSchema constrains JSON output; it needs ResponseMIMEType
+	// "application/json".
+	ResponseSchema *Schema
+
+	// Sampling settings; nil or 0 keeps the model's default.
+	Temperature     *float32
+	TopP            *float32
+	MaxOutputTokens int32
+}
+
+// Schema is an SDK-neutral subset of the OpenAPI schema Gemini accepts for
+// structured output.
+type Schema struct {
+	Type       SchemaType
+	Properties map[string]*Schema
+	Items      *Schema
+	Required   []string
+}
+
+// SchemaType is the JSON type a Schema describes.
+type SchemaType int
+
+const (
+	TypeString SchemaType = iota + 1
+	TypeNumber
+	TypeArray
+	TypeObject
+)
+
+// Generator sends a prompt to an LLM and returns its text reply.
+// Implementations wrap a specific SDK so the rewriter doesn't depend on one.
+type Generator interface {
+	Generate(ctx context.Context, req GenerateRequest) (string, error)
+}
+
+// legacyGenerator uses the deprecated github.com/google/generative-ai-go SDK.
+type legacyGenerator struct {
+	gm *genai.GenerativeModel
+}
+
+// NewLegacyGenerator returns a Generator backed by a legacy SDK model.
+func NewLegacyGenerator(gm *genai.GenerativeModel) Generator {
+	return legacyGenerator{gm: gm}
+}
+
+func (g legacyGenerator) Generate(ctx context.Context, req GenerateRequest) (string, error) {
+	parts := make([]genai.Part, 0, len(req.Parts))
+	for _, p := range req.Parts {
+		parts = append(parts, genai.Text(p))
+	}
+	// Copy so concurrent requests don't share generation settings.
+	gm := *g.gm
+	gm.ResponseMIMEType = req.ResponseMIMEType
+	gm.ResponseSchema = legacySchema(req.ResponseSchema)
+	if req.Temperature != nil {
+		gm.Temperature = req.Temperature
+	}
+	if req.TopP != nil {
+		gm.TopP = req.TopP
+	}
+	if req.MaxOutputTokens > 0 {
+		gm.SetMaxOutputTokens(req.MaxOutputTokens)
+	}
+	resp, err := gm.GenerateContent(ctx, parts...)
+	if err != nil {
+		return "", err
+	}
+	return extractText(resp), nil
+}
+
+// unifiedGenerator uses the google.golang.org/genai SDK.
+type unifiedGenerator struct {
+	client    *unified.Client
+	modelName string
+}
+
+// NewUnifiedGenerator returns a Generator backed by the google.golang.org/genai
+// client.
+func NewUnifiedGenerator(client *unified.Client, modelName string) Generator {
+	return unifiedGenerator{client: client, modelName: modelName}
+}
+
+func (g unifiedGenerator) Generate(ctx context.Context, req GenerateRequest) (string, error) {
+	parts := make([]*unified.Part, 0, len(req.Parts))
+	for _, p := range req.Parts {
+		parts = append(parts, unified.NewPartFromText(p))
+	}
+	contents := []*unified.Content{unified.NewContentFromParts(parts, unified.RoleUser)}
+	cfg := &unified.GenerateContentConfig{
+		ResponseMIMEType: req.ResponseMIMEType,
+		ResponseSchema:   unifiedSchema(req.ResponseSchema),
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		MaxOutputTokens:  req.MaxOutputTokens,
+	}
+	resp, err := g.client.Models.GenerateContent(ctx, g.modelName, contents, cfg)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text(), nil
+}
+
+func legacySchema(s *Schema) *genai.Schema {
+	if s == nil {
+		return nil
+	}
+	out := &genai.Schema{Items: legacySchema(s.Items), Required: s.Required}
+	switch s.Type {
+	case TypeString:
+		out.Type = genai.TypeString
+	case TypeNumber:
+		out.Type = genai.TypeNumber
+	case TypeArray:
+		out.Type = genai.TypeArray
+	case TypeObject:
+		out.Type = genai.TypeObject
+	}
+	if s.Properties != nil {
+		out.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for k, v := range s.Properties {
+			out.Properties[k] = legacySchema(v)
+		}
+	}
+	return out
+}
+
+func unifiedSchema(s *Schema) *unified.Schema {
+	if s == nil {
+		return nil
+	}
+	out := &unified.Schema{Items: unifiedSchema(s.Items), Required: s.Required}
+	switch s.Type {
+	case TypeString:
+		out.Type = unified.TypeString
+	case TypeNumber:
+		out.Type = unified.TypeNumber
+	case TypeArray:
+		out.Type = unified.TypeArray
+	case TypeObject:
+		out.Type = unified.TypeObject
+	}
+	if s.Properties != nil {
+		out.Properties = make(map[string]*unified.Schema, len(s.Properties))
+		for k, v := range s.Properties {
+			out.Properties[k] = unifiedSchema(v)
+		}
+	}
+	return out
+}
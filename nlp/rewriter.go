@@ -3,8 +3,8 @@ package nlp
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"math"
 	"strings"
 
 	genai "github.com/google/generative-ai-go/genai"
@@ -14,6 +14,34 @@ import (
 type Rewrite struct {
 	Primary      string   `json:"primary"`
 	Alternatives []string `json:"alternatives"`
+	// Confidence is the model's 0–1 estimate that Primary is what the user
+	// meant; see Gate. It is nil when the model didn't give one.
+	Confidence *float64 `json:"confidence,omitempty"`
+}
+
+// Correction outcomes reported by Gate.
+const (
+	CorrectionNone     = "none"     // Primary already equals the raw query
+	CorrectionApplied  = "applied"  // Primary differs and was kept
+	CorrectionRejected = "rejected" // Primary was reverted to the raw query
+)
+
+// Gate reverts a correction the model isn't sure of: when Confidence is
+// below min, Primary is replaced by raw so correctly spelled but unusual
+// queries (rare brands, model codes) aren't rewritten into something worse.
+// A missing Confidence is unknown, not low, and the correction is kept.
+// Alternatives are kept. It returns the resulting rewrite and one of the
+// Correction outcomes.
+func (r Rewrite) Gate(raw string, min float64) (Rewrite, string) {
+	raw = strings.TrimSpace(raw)
+	if strings.EqualFold(strings.TrimSpace(r.Primary), raw) {
+		return r, CorrectionNone
+	}
+	if r.Confidence == nil || *r.Confidence >= min {
+		return r, CorrectionApplied
+	}
+	r.Primary = raw
+	return r, CorrectionRejected
 }
 
 // Extract plain text from a GenerateContentResponse (legacy SDK).
@@ -32,6 +60,18 @@ func extractText(resp *genai.GenerateContentResponse) string {
 	return b.String()
 }
 
+// stripCodeFence removes a ```json ... ``` wrapper that models without JSON
+// mode often add despite being told not to.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimPrefix(s, "json")
+	return strings.TrimSpace(strings.TrimSuffix(s, "```"))
+}
+
 // Normalize output: trim, dedupe, drop empties, limit alts.
 func normalize(r Rewrite) Rewrite {
 	seen := map[string]struct{}{}
@@ -46,7 +86,11 @@ func normalize(r Rewrite) Rewrite {
 		seen[strings.ToLower(s)] = struct{}{}
 		return s, true
 	}
-	out := Rewrite{}
+	var out Rewrite
+	if r.Confidence != nil {
+		c := math.Max(0, math.Min(1, *r.Confidence))
+		out.Confidence = &c
+	}
 	if p, ok := clean(r.Primary); ok {
 		out.Primary = p
 	}
@@ -61,12 +105,74 @@ func normalize(r Rewrite) Rewrite {
 	return out
 }
 
+// Trace records what the LLM actually returned, for debugging rewrites.
+type Trace struct {
+	// Raw is the model's reply before decoding and normalize.
+	Raw string `json:"raw"`
+	// Decoded is false when Raw wasn't valid JSON and the original query
+	// was used instead.
+	Decoded bool `json:"decoded"`
+	// Status is one of the Rewrite statuses, telling a clean query the
+	// model left alone (RewriteOK, no alternatives) from a fallback to the
+	// raw query.
+	Status string `json:"status"`
+}
+
+// Rewrite statuses reported in Trace.Status.
+const (
+	RewriteOK       = "ok"       // the model ran and its reply was used
+	RewriteFallback = "fallback" // the model replied, but unusably; raw query used
+	RewriteFailed   = "failed"   // the model call failed; raw query used
+	RewriteSkipped  = "skipped"  // rewriting was turned off; raw query used
+)
+
+// RewriteOptions tune how RewriteQuery calls the model.
+type RewriteOptions struct {
+	// JSONMode asks the model for application/json output matching the
+	// Rewrite schema, which is far more reliable than prompt instructions
+	// alone. Turn it off for models that don't support structured output;
+	// the reply is then parsed from plain text.
+	JSONMode bool
+
+	// Temperature, TopP and MaxOutputTokens are passed to the model; nil
+	// or 0 keeps the model's default. A low temperature keeps corrections
+	// conservative instead of drifting from what the user meant.
+	Temperature     *float32
+	TopP            *float32
+	MaxOutputTokens int32
+}
+
+// DefaultRewriteOptions returns the options RewriteQuery uses.
+func DefaultRewriteOptions() RewriteOptions {
+	t := float32(0.1)
+	return RewriteOptions{JSONMode: true, Temperature: &t, MaxOutputTokens: 256}
+}
+
+// rewriteSchema mirrors Rewrite for JSON mode.
+var rewriteSchema = &Schema{
+	Type: TypeObject,
+	Properties: map[string]*Schema{
+		"primary":      {Type: TypeString},
+		"alternatives": {Type: TypeArray, Items: &Schema{Type: TypeString}},
+		"confidence":   {Type: TypeNumber},
+	},
+	Required: []string{"primary", "alternatives", "confidence"},
+}
+
 // RewriteQuery calls Gemini to spell-correct/normalize the query.
-// modelName e.g. "gemini-1.5-flash" or "gemini-1.5-pro".
-func RewriteQuery(ctx context.Context, gm *genai.GenerativeModel, raw string) (Rewrite, error) {
+// The generator wraps a model, e.g. "gemini-1.5-flash" or "gemini-1.5-pro".
+func RewriteQuery(ctx context.Context, g Generator, raw string) (Rewrite, error) {
+	r, _, err := RewriteQueryTrace(ctx, g, raw, DefaultRewriteOptions())
+	return r, err
+}
+
+// RewriteQueryTrace is RewriteQuery with explicit options that also returns
+// the raw model output.
+func RewriteQueryTrace(ctx context.Context, g Generator, raw string, opts RewriteOptions) (Rewrite, Trace, error) {
+	var tr Trace
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
-		return Rewrite{}, errors.New("empty query")
+		return Rewrite{}, tr, ErrEmptyQuery
 	}
 
 	// System-style concise instruction to force strict JSON.
@@ -79,7 +185,8 @@ Tasks:
 
 {
   "primary": "<one corrected query string>",
-  "alternatives": ["<alt1>", "<alt2>"]
+  "alternatives": ["<alt1>", "<alt2>"],
+  "confidence": <0.0-1.0>
 }
 
 Guidelines:
@@ -87,28 +194,45 @@ Guidelines:
 - Prefer common brand spellings (e.g., "samsung", "google", "iphone").
 - If the input is already clean, return it unchanged as "primary".
 - Provide up to 2 short alternatives (synonyms, close spellings) or an empty list.
+- "confidence" is how sure you are that "primary" is what the user meant. Use a
+  low value when the input may be a correctly spelled rare brand or model code.
 `
 
 	inp := fmt.Sprintf("Input: %q", raw)
-	resp, err := gm.GenerateContent(ctx, genai.Text(prompt), genai.Text(inp))
+	req := GenerateRequest{
+		Parts:           []string{prompt, inp},
+		Temperature:     opts.Temperature,
+		TopP:            opts.TopP,
+		MaxOutputTokens: opts.MaxOutputTokens,
+	}
+	if opts.JSONMode {
+		req.ResponseMIMEType = "application/json"
+		req.ResponseSchema = rewriteSchema
+	}
+	txt, err := g.Generate(ctx, req)
 	if err != nil {
-		return Rewrite{}, err
+		tr.Status = RewriteFailed
+		return Rewrite{}, tr, fmt.Errorf("%w: %w", ErrGeneration, err)
 	}
+	tr.Raw = txt
+	tr.Status = RewriteFallback
 
-	txt := extractText(resp)
-	dec := json.NewDecoder(strings.NewReader(txt))
+	dec := json.NewDecoder(strings.NewReader(stripCodeFence(txt)))
 	dec.DisallowUnknownFields()
 
 	var r Rewrite
 	if err := dec.Decode(&r); err != nil {
 		// Fallback: use original when model returns bad JSON
-		return Rewrite{Primary: raw, Alternatives: nil}, nil
+		return Rewrite{Primary: raw, Alternatives: nil}, tr, nil
 	}
+	tr.Decoded = true
 
 	r = normalize(r)
 	if r.Primary == "" {
 		// Fallback if model blanked primary
 		r.Primary = raw
+		return r, tr, nil
 	}
-	return r, nil
+	tr.Status = RewriteOK
+	return r, tr, nil
 }
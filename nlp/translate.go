@@ -0,0 +1,140 @@
+package nlp
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Translation is a shopper's query translated into the catalog language.
+type Translation struct {
+	Original   string `json:"original"`
+	Translated string `json:"translated"`
+	// Language is the language the model detected in Original, e.g.
+	// "German". Translated equals Original when it is the target language.
+	Language string `json:"language"`
+}
+
+// TranslateOptions configure a Translator.
+type TranslateOptions struct {
+	// Target is the catalog language, e.g. "English".
+	Target string
+	// CacheSize is how many translations are kept, least recently used
+	// evicted first. 0 disables caching.
+	CacheSize int
+	// JSONMode is as in RewriteOptions.
+	JSONMode bool
+}
+
+// Translator translates queries into the catalog language with an LLM so
+// non-English shoppers can match English product data. Each uncached query
+// costs one generation call before rewriting and embedding, so it is opt-in;
+// repeated queries are served from an in-memory cache.
+type Translator struct {
+	g    Generator
+	opts TranslateOptions
+
+	mu    sync.Mutex
+	ll    *list.List // of Translation, front = most recently used
+	items map[string]*list.Element
+}
+
+// NewTranslator returns a Translator using g.
+func NewTranslator(g Generator, opts TranslateOptions) *Translator {
+	if opts.Target == "" {
+		opts.Target = "English"
+	}
+	return &Translator{g: g, opts: opts, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// translationSchema mirrors the reply Translate asks for in JSON mode.
+var translationSchema = &Schema{
+	Type: TypeObject,
+	Properties: map[string]*Schema{
+		"language":    {Type: TypeString},
+		"translation": {Type: TypeString},
+	},
+	Required: []string{"language", "translation"},
+}
+
+// Translate returns query in the target language. On error the caller
+// should search the original query.
+func (t *Translator) Translate(ctx context.Context, query string) (Translation, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return Translation{}, ErrEmptyQuery
+	}
+	key := strings.ToLower(query)
+	if tr, ok := t.cached(key); ok {
+		tr.Original = query
+		return tr, nil
+	}
+
+	prompt := fmt.Sprintf(`
+You translate e-commerce search queries into %s.
+Return STRICT JSON ONLY (no markdown, no prose):
+
+{"language": "<language of the input>", "translation": "<the query in %[1]s>"}
+
+Guidelines:
+- Keep brand names, model numbers and units unchanged.
+- If the input is already in %[1]s, return it unchanged.
+`, t.opts.Target)
+	req := GenerateRequest{Parts: []string{prompt, fmt.Sprintf("Input: %q", query)}}
+	if t.opts.JSONMode {
+		req.ResponseMIMEType = "application/json"
+		req.ResponseSchema = translationSchema
+	}
+	txt, err := t.g.Generate(ctx, req)
+	if err != nil {
+		return Translation{}, fmt.Errorf("%w: %w", ErrGeneration, err)
+	}
+	var reply struct {
+		Language    string `json:"language"`
+		Translation string `json:"translation"`
+	}
+	if err := json.Unmarshal([]byte(stripCodeFence(txt)), &reply); err != nil {
+		return Translation{}, fmt.Errorf("%w: invalid translation reply: %w", ErrGeneration, err)
+	}
+	tr := Translation{Original: query, Translated: strings.TrimSpace(reply.Translation), Language: reply.Language}
+	if tr.Translated == "" {
+		return Translation{}, fmt.Errorf("%w: %w", ErrGeneration, errors.New("empty translation"))
+	}
+	t.store(key, tr)
+	return tr, nil
+}
+
+func (t *Translator) cached(key string) (Translation, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	el, ok := t.items[key]
+	if !ok {
+		return Translation{}, false
+	}
+	t.ll.MoveToFront(el)
+	return el.Value.(cachedTranslation).tr, true
+}
+
+type cachedTranslation struct {
+	key string
+	tr  Translation
+}
+
+func (t *Translator) store(key string, tr Translation) {
+	if t.opts.CacheSize <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if el, ok := t.items[key]; ok {
+		t.ll.Remove(el)
+	}
+	t.items[key] = t.ll.PushFront(cachedTranslation{key: key, tr: tr})
+	for t.ll.Len() > t.opts.CacheSize {
+		delete(t.items, t.ll.Remove(t.ll.Back()).(cachedTranslation).key)
+	}
+}
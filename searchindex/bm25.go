@@ -0,0 +1,58 @@
+package searchindex
+
+import "math"
+
+// BM25 parameters: k1 saturates repeated terms, b scales for field length.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Lexical scorers accepted by Config.Lexical.
+const (
+	LexicalNone = ""
+	LexicalBM25 = "bm25"
+)
+
+// lexicalStats holds the per-corpus statistics BM25 needs, built at Rebuild.
+type lexicalStats struct {
+	avgLen float64
+}
+
+// buildTermStats records each doc's term frequencies over title, brand and
+// description, and returns the corpus averages.
+func buildTermStats(docs []productDoc, tok Tokenizer) lexicalStats {
+	total := 0
+	for i := range docs {
+		ws := words(tok, docs[i].P.Title+" "+docs[i].P.Brand+" "+docs[i].P.Description)
+		tf := make(map[string]int, len(ws))
+		for _, w := range ws {
+			tf[w]++
+		}
+		docs[i].terms, docs[i].termCount = tf, len(ws)
+		total += len(ws)
+	}
+	if len(docs) == 0 {
+		return lexicalStats{}
+	}
+	return lexicalStats{avgLen: float64(total) / float64(len(docs))}
+}
+
+// bm25 scores d against the query words. The caller holds ix.mu.
+func (ix *Index) bm25(qWords []string, d productDoc) float64 {
+	if d.termCount == 0 || ix.lex.avgLen == 0 {
+		return 0
+	}
+	n := float64(len(ix.docs))
+	var s float64
+	for _, w := range qWords {
+		tf := float64(d.terms[w])
+		if tf == 0 {
+			continue
+		}
+		df := float64(ix.df[w])
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		s += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(d.termCount)/ix.lex.avgLen))
+	}
+	return s
+}
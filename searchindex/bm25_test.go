@@ -0,0 +1,73 @@
+package searchindex
+
+import (
+	"context"
+	"testing"
+)
+
+// rankedScores searches ix for q and returns each product's score by ID
+// along with the top result's ID.
+func rankedScores(t *testing.T, ix *Index, q string) (uint, map[uint]float64) {
+	t.Helper()
+	res, err := ix.Search(context.Background(), q, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) == 0 {
+		t.Fatalf("%q: no results", q)
+	}
+	scores := make(map[uint]float64, len(res))
+	for _, r := range res {
+		scores[r.Product.ID] = r.Score
+	}
+	return res[0].Product.ID, scores
+}
+
+func TestLexicalBM25VersusJaroWinkler(t *testing.T) {
+	jw, _ := newTestIndex(t, DefaultConfig(0, 1), testCatalog())
+	cfg := DefaultConfig(0, 0)
+	cfg.Lexical = LexicalBM25
+	cfg.LexicalWeight = 1
+	bm, _ := newTestIndex(t, cfg, testCatalog())
+
+	// Exact words: both rank the product that has them first, but only
+	// BM25 leaves products sharing no query word at 0.
+	for _, tc := range []struct {
+		q    string
+		want uint
+	}{
+		{"triple camera", 1},
+		{"brown leather wallet", 8},
+		{"running shoes", 7},
+	} {
+		jwTop, jwScores := rankedScores(t, jw, tc.q)
+		bmTop, bmScores := rankedScores(t, bm, tc.q)
+		if jwTop != tc.want || bmTop != tc.want {
+			t.Errorf("%q: top result %d with Jaro-Winkler and %d with BM25, want %d", tc.q, jwTop, bmTop, tc.want)
+		}
+		for _, id := range []uint{2, 3} {
+			if bmScores[id] != 0 {
+				t.Errorf("%q: BM25 scores unrelated product %d %.3f, want 0", tc.q, id, bmScores[id])
+			}
+			if jwScores[id] == 0 {
+				t.Errorf("%q: Jaro-Winkler scores unrelated product %d 0, want partial credit", tc.q, id)
+			}
+		}
+	}
+
+	// Rare words: "triple" is in one description and "camera" in four, so
+	// BM25 separates the S23 from the other camera phones by more.
+	_, jwScores := rankedScores(t, jw, "triple camera")
+	_, bmScores := rankedScores(t, bm, "triple camera")
+	if jwGap, bmGap := jwScores[1]-jwScores[5], bmScores[1]-bmScores[5]; bmGap <= jwGap {
+		t.Errorf("triple camera: BM25 margin %.3f, want above Jaro-Winkler's %.3f", bmGap, jwGap)
+	}
+
+	// Typos: Jaro-Winkler still finds the wallet, BM25 matches nothing.
+	if top, _ := rankedScores(t, jw, "leathr walet"); top != 8 {
+		t.Errorf("leathr walet: Jaro-Winkler top result %d, want 8", top)
+	}
+	if _, scores := rankedScores(t, bm, "leathr walet"); scores[8] != 0 {
+		t.Errorf("leathr walet: BM25 scores the wallet %.3f, want 0", scores[8])
+	}
+}
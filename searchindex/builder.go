@@ -0,0 +1,306 @@
+package searchindex
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// MaxEmbedBatch is the most texts sent in one batch embedding call; Gemini
+// rejects larger batches. See Config.EmbedBatchSize.
+const MaxEmbedBatch = 100
+
+// Builder assembles a new corpus incrementally, e.g. from a stream too large
+// to buffer. Nothing is visible to searches until Commit.
+type Builder struct {
+	ix    *Index
+	cfg   Config
+	imgEm ImageEmbedder
+	prev  map[uint]productDoc
+	docs  []productDoc
+	// proj projects new text vectors as they are added; fit fits a new
+	// projection at Commit instead. See Config.PCADimensions.
+	proj *projection
+	fit  bool
+	sel  FieldSelector
+	// patch is set for builds from newPatchBuilder, whose caller already
+	// holds ix.patchMu.
+	patch bool
+}
+
+// NewBuilder starts a build that will replace the current corpus. Like
+// Rebuild, it reuses embeddings of products that haven't changed.
+func (ix *Index) NewBuilder() *Builder {
+	return ix.newBuilder(false)
+}
+
+// newBuilder is NewBuilder; keepProjection keeps the current PCA
+// projection whatever the Config says, for builds that start from the
+// current corpus and so must stay comparable with it.
+func (ix *Index) newBuilder(keepProjection bool) *Builder {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	prev := make(map[uint]productDoc, len(ix.docs))
+	for _, d := range ix.docs {
+		prev[d.P.ID] = d
+	}
+	b := &Builder{ix: ix, cfg: ix.cfg, prev: prev, sel: ix.fieldSel}
+	if ix.cfg.ImageWeight > 0 {
+		b.imgEm = ix.imgEm
+	}
+	want := ix.cfg.PCADimensions
+	switch {
+	case keepProjection || ix.proj != nil && ix.proj.out() == want:
+		b.proj = ix.proj
+	default:
+		// Stored vectors projected under another projection can't be
+		// reused, and a new one is fitted on full vectors.
+		if ix.proj != nil {
+			b.prev = nil
+		}
+		b.fit = want > 0
+	}
+	return b
+}
+
+// Add embeds products and appends them to the build. Embedding calls are
+// batched when the Embedder implements BatchEmbedder. On error the build
+// keeps what was added before this call.
+func (b *Builder) Add(ctx context.Context, products []Product) error {
+	products = b.ix.withInternalIDs(products)
+	batch := make([]productDoc, 0, len(products))
+	var jobs []embedJob
+	for _, p := range products {
+		d, js, ok := prepareDoc(p, b.prev[p.ID], b.cfg, b.sel, b.imgEm != nil)
+		if !ok {
+			continue
+		}
+		for _, j := range js {
+			j.doc = len(batch)
+			jobs = append(jobs, j)
+		}
+		batch = append(batch, d)
+	}
+	var textJobs, imageJobs []embedJob
+	for _, j := range jobs {
+		if j.kind == vecImage {
+			imageJobs = append(imageJobs, j)
+		} else {
+			textJobs = append(textJobs, j)
+		}
+	}
+	if err := b.ix.runEmbedJobs(ctx, batch, textJobs, b.cfg); err != nil {
+		return err
+	}
+	if err := b.ix.embedImages(ctx, b.imgEm, batch, imageJobs, b.cfg); err != nil {
+		return err
+	}
+	// Store unit vectors so searches score with a plain dot product.
+	for i := range batch {
+		for _, k := range []vecKind{vecCombined, vecTitle, vecDescription, vecImage} {
+			if v := batch[i].vec(k); *v != nil {
+				*v = unitVector(*v)
+				if k != vecImage {
+					*v = b.proj.apply(*v)
+				}
+			}
+		}
+	}
+	for _, d := range batch {
+		if len(b.docs) > 0 && len(d.Embedding) != len(b.docs[0].Embedding) {
+			return fmt.Errorf("%w: product %d has %d dimensions, want %d",
+				ErrDimensionMismatch, d.P.ID, len(d.Embedding), len(b.docs[0].Embedding))
+		}
+		b.docs = append(b.docs, d)
+	}
+	return nil
+}
+
+// SetBatchSize overrides Config.EmbedBatchSize for this build, e.g. to
+// try a different size on one reindex; 0 restores MaxEmbedBatch.
+func (b *Builder) SetBatchSize(n int) error {
+	cfg := b.cfg
+	cfg.EmbedBatchSize = n
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	b.cfg = cfg
+	return nil
+}
+
+// BatchSize returns the number of texts per batch embedding call this
+// build uses.
+func (b *Builder) BatchSize() int { return b.cfg.embedBatchSize() }
+
+// Len returns the number of products added so far.
+func (b *Builder) Len() int { return len(b.docs) }
+
+// Commit makes the built corpus the one searches see.
+func (b *Builder) Commit() {
+	if !b.patch {
+		b.ix.patchMu.Lock()
+		defer b.ix.patchMu.Unlock()
+	}
+	if b.fit {
+		vecs := make([][]float32, len(b.docs))
+		for i, d := range b.docs {
+			vecs[i] = d.Embedding
+		}
+		if b.proj = fitPCA(vecs, b.cfg.PCADimensions); b.proj != nil {
+			for i := range b.docs {
+				for _, k := range []vecKind{vecCombined, vecTitle, vecDescription} {
+					if v := b.docs[i].vec(k); *v != nil {
+						*v = b.proj.apply(*v)
+					}
+				}
+			}
+		}
+	}
+	byID := make(map[uint]int, len(b.docs))
+	for i, d := range b.docs {
+		byID[d.P.ID] = i
+	}
+	vocab := buildVocab(b.docs, b.cfg.tokenizer())
+	df := buildDocFreq(b.docs, b.cfg.tokenizer())
+	lex := buildTermStats(b.docs, b.cfg.tokenizer())
+
+	ix := b.ix
+	ix.mu.Lock()
+	ix.docs = b.docs
+	ix.byID = byID
+	ix.vocab = vocab
+	ix.df = df
+	ix.lex = lex
+	ix.proj = b.proj
+	ix.generation++
+	ix.mu.Unlock()
+	// Patches would repeat it on every Upsert and Sync tick.
+	if !b.patch && b.cfg.small(len(b.docs)) {
+		log.Printf("searchindex: %d products indexed, under smallCorpus=%d; semantic scores barely differ at this size, so rankings lean on fuzzy matching",
+			len(b.docs), b.cfg.SmallCorpus)
+	}
+}
+
+// vecKind names one of the vectors stored on a productDoc.
+type vecKind int
+
+const (
+	vecCombined vecKind = iota
+	vecTitle
+	vecDescription
+	vecImage // job text is the image URL
+)
+
+func (d *productDoc) vec(k vecKind) *[]float32 {
+	switch k {
+	case vecTitle:
+		return &d.TitleEmbedding
+	case vecDescription:
+		return &d.DescriptionEmbedding
+	case vecImage:
+		return &d.ImageEmbedding
+	}
+	return &d.Embedding
+}
+
+// embedJob is a text waiting to be embedded into docs[doc].vec(kind).
+type embedJob struct {
+	doc  int
+	kind vecKind
+	text string
+}
+
+// prepareDoc builds p's doc, reusing prev's vectors when the text is
+// unchanged and returning jobs for the vectors still to embed. It reports
+// false for products with nothing to index. images adds a job for the
+// product's image.
+func prepareDoc(p Product, prev productDoc, cfg Config, sel FieldSelector, images bool) (productDoc, []embedJob, bool) {
+	if cfg.StripHTML {
+		p.Description = stripHTML(p.Description)
+	}
+	embeds := sel.embeds(p)
+	var desc, brand, variants string
+	if embeds(EmbedDescription) {
+		desc = embeddedDescription(p, cfg)
+	}
+	if embeds(EmbedBrand) {
+		brand = p.Brand
+	}
+	if cfg.BrandRepeat > 1 && brand != "" {
+		brand = strings.TrimSpace(strings.Repeat(brand+" ", cfg.BrandRepeat))
+	}
+	if embeds(EmbedVariants) {
+		variants = variantText(p.Variants)
+	}
+	joined := strings.TrimSpace(strings.Join([]string{p.Title, brand, desc, variants}, " "))
+	if joined == "" {
+		return productDoc{}, nil, false
+	}
+	hashed := joined
+	if cfg.DocumentInstruction != "" {
+		hashed = cfg.DocumentInstruction + "\x00" + hashed
+	}
+	if p.ImageURL != "" {
+		hashed += "\x00" + p.ImageURL
+	}
+	d := productDoc{P: p, SearchText: joined, Hash: sha256.Sum256([]byte(hashed))}
+	unchanged := prev.Hash == d.Hash
+
+	var jobs []embedJob
+	want := func(k vecKind, text string) {
+		if old := *prev.vec(k); unchanged && old != nil {
+			*d.vec(k) = old
+			return
+		}
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		if k != vecImage {
+			text = cfg.DocumentInstruction + text
+		}
+		jobs = append(jobs, embedJob{kind: k, text: text})
+	}
+	want(vecCombined, joined)
+	if cfg.FieldEmbeddings {
+		want(vecTitle, p.Title+" "+p.Brand)
+		want(vecDescription, desc)
+	}
+	if images {
+		want(vecImage, p.ImageURL)
+	}
+	return d, jobs, true
+}
+
+// runEmbedJobs fills in the vectors jobs ask for, in batches when the
+// embedder supports it.
+func (ix *Index) runEmbedJobs(ctx context.Context, docs []productDoc, jobs []embedJob, cfg Config) error {
+	be, ok := ix.em.(BatchEmbedder)
+	if !ok || len(jobs) == 1 {
+		for _, j := range jobs {
+			vec, err := ix.embed(ctx, docs[j.doc].P.ID, j.text, cfg)
+			if err != nil {
+				return err
+			}
+			*docs[j.doc].vec(j.kind) = vec
+		}
+		return nil
+	}
+	size := cfg.embedBatchSize()
+	for start := 0; start < len(jobs); start += size {
+		chunk := jobs[start:min(start+size, len(jobs))]
+		texts := make([]string, len(chunk))
+		for i, j := range chunk {
+			texts[i] = j.text
+		}
+		vecs, err := ix.embedBatch(ctx, be, docs[chunk[0].doc].P.ID, texts, cfg)
+		if err != nil {
+			return err
+		}
+		for i, j := range chunk {
+			*docs[j.doc].vec(j.kind) = vecs[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package searchindex
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRebuildReusesUnchangedEmbeddings(t *testing.T) {
+	ctx := context.Background()
+	products := testCatalog()
+	ix, em := newTestIndex(t, DefaultConfig(0.7, 0.3), products)
+	perProduct := em.calls.Load() / int64(len(products))
+	if perProduct == 0 || em.calls.Load()%int64(len(products)) != 0 {
+		t.Fatalf("first build made %d embed calls for %d products", em.calls.Load(), len(products))
+	}
+
+	rebuild := func(products []Product, want int64) {
+		t.Helper()
+		before := em.calls.Load()
+		if err := ix.Rebuild(ctx, products); err != nil {
+			t.Fatal(err)
+		}
+		if got := em.calls.Load() - before; got != want {
+			t.Errorf("rebuild made %d embed calls, want %d", got, want)
+		}
+	}
+
+	rebuild(products, 0)
+
+	products[2].Description = "USB-C iPhone with a 48MP camera"
+	products[5].Price = 599 // not embedded
+	rebuild(products, perProduct)
+
+	products = append(products, Product{ID: 9, Title: "Galaxy Buds", Brand: "Samsung", Description: "Wireless earbuds"})
+	rebuild(products, perProduct)
+
+	rebuild(products[1:], 0)
+
+	res, err := ix.Search(ctx, "48mp camera", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Product.ID != 3 {
+		t.Errorf("top result %v, want the re-embedded product 3", res)
+	}
+}
@@ -0,0 +1,135 @@
+package searchindex
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// cacheEntryOverhead approximates the per-entry bookkeeping (list element,
+// map slot, slice and string headers) on top of key and vector bytes.
+const cacheEntryOverhead = 128
+
+// CacheStats describes the query embedding cache.
+type CacheStats struct {
+	Entries  int
+	Bytes    int64 // approximate memory held, including overhead
+	MaxBytes int64
+	Hits     uint64
+	Misses   uint64
+}
+
+// vecCache is an LRU of query embeddings bounded by approximate memory
+// rather than entry count, since a 768-dim vector alone is 3 KiB. The zero
+// value is ready to use.
+type vecCache struct {
+	mu     sync.Mutex
+	ll     *list.List // front = most recently used
+	items  map[string]*list.Element
+	bytes  int64
+	hits   uint64
+	misses uint64
+}
+
+type cacheEntry struct {
+	key string
+	vec []float32
+}
+
+func entrySize(key string, vec []float32) int64 {
+	return int64(len(key)) + 4*int64(len(vec)) + cacheEntryOverhead
+}
+
+func (c *vecCache) get(key string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		c.hits++
+		return el.Value.(*cacheEntry).vec, true
+	}
+	c.misses++
+	return nil, false
+}
+
+// put stores vec under key and evicts least recently used entries until
+// the cache fits in maxBytes. Entries larger than the whole budget are not
+// stored.
+func (c *vecCache) put(key string, vec []float32, maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.items == nil {
+		c.items = map[string]*list.Element{}
+		c.ll = list.New()
+	}
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if size := entrySize(key, vec); size <= maxBytes {
+		c.items[key] = c.ll.PushFront(&cacheEntry{key: key, vec: vec})
+		c.bytes += size
+	}
+	for c.bytes > maxBytes {
+		c.remove(c.ll.Back())
+	}
+}
+
+// remove drops el; the caller holds c.mu.
+func (c *vecCache) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*cacheEntry)
+	delete(c.items, e.key)
+	c.bytes -= entrySize(e.key, e.vec)
+}
+
+func (c *vecCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Entries: len(c.items), Bytes: c.bytes, Hits: c.hits, Misses: c.misses}
+}
+
+// embedQuery is embed for query text under cfg.QueryInstruction, served
+// from the query cache when cfg.QueryCacheBytes allows one.
+func (ix *Index) embedQuery(ctx context.Context, text string, cfg Config) ([]float32, error) {
+	text = cfg.QueryInstruction + text
+	if cfg.QueryCacheBytes <= 0 {
+		return ix.embed(ctx, 0, text, cfg)
+	}
+	if vec, ok := ix.qcache.get(text); ok {
+		return vec, nil
+	}
+	vec, err := ix.embed(ctx, 0, text, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ix.qcache.put(text, vec, cfg.QueryCacheBytes)
+	return vec, nil
+}
+
+// QueryCacheStats reports the query embedding cache's size and hit rate.
+func (ix *Index) QueryCacheStats() CacheStats {
+	s := ix.qcache.stats()
+	s.MaxBytes = ix.Config().QueryCacheBytes
+	return s
+}
+
+// WarmQueryCache embeds queries into the query cache ahead of traffic, e.g.
+// popular queries replayed at startup. It works before anything is indexed,
+// does nothing when the cache is disabled, and stops at the first error. It
+// returns how many queries are now cached.
+func (ix *Index) WarmQueryCache(ctx context.Context, queries []string) (int, error) {
+	cfg := ix.Config()
+	if cfg.QueryCacheBytes <= 0 {
+		return 0, nil
+	}
+	n := 0
+	for _, q := range queries {
+		if q = parseHints(q).text; q == "" {
+			continue
+		}
+		if _, err := ix.embedQuery(ctx, q, cfg); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,74 @@
+package searchindex
+
+import (
+	"context"
+	"sort"
+)
+
+const (
+	// categoryVoters is how many of the semantically closest results vote
+	// on the query's category.
+	categoryVoters = 10
+	// categoryMinShare is the share of the vote a category needs to be
+	// inferred; below it the query is treated as ambiguous.
+	categoryMinShare = 0.5
+)
+
+// inferCategory predicts the query's category from results: the closest
+// categoryVoters by semantic score vote, weighted by that score, and the
+// winner is returned if it has at least categoryMinShare of the vote.
+// Uncategorized products (CategoryID 0) don't vote.
+func inferCategory(results []SearchResult) (uint, bool) {
+	idx := make([]int, 0, len(results))
+	for i, r := range results {
+		if r.Product.CategoryID != 0 && r.sig.semantic > 0 {
+			idx = append(idx, i)
+		}
+	}
+	sort.Slice(idx, func(a, b int) bool {
+		return results[idx[a]].sig.semantic > results[idx[b]].sig.semantic
+	})
+	votes := map[uint]float64{}
+	var total float64
+	for _, i := range idx[:min(categoryVoters, len(idx))] {
+		s := results[i].sig.semantic
+		votes[results[i].Product.CategoryID] += s
+		total += s
+	}
+	var best uint
+	for c, v := range votes {
+		if best == 0 || v > votes[best] || v == votes[best] && c < best {
+			best = c
+		}
+	}
+	if best == 0 || votes[best] < categoryMinShare*total {
+		return 0, false
+	}
+	return best, true
+}
+
+// InferCategory predicts which category query is about, from the categories
+// of the products closest to it in meaning, as Config.CategoryBoost does.
+// It reports false when no category clearly wins, e.g. "apple" in a
+// catalog with as many phones as groceries.
+func (ix *Index) InferCategory(ctx context.Context, query string) (uint, bool, error) {
+	results, err := ix.Search(ctx, query, 0)
+	if err != nil {
+		return 0, false, err
+	}
+	cat, ok := inferCategory(results)
+	return cat, ok, nil
+}
+
+// BoostedCategory returns the category Config.CategoryBoost favoured in
+// results, the output of a search, read from their "category" boosts. It
+// reports false when no result was boosted. Unlike InferCategory it
+// doesn't search again.
+func BoostedCategory(results []SearchResult) (uint, bool) {
+	for _, r := range results {
+		if _, ok := r.Boosts["category"]; ok {
+			return r.Product.CategoryID, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,39 @@
+package searchindex
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBoostedCategoryMatchesInferCategory(t *testing.T) {
+	ctx := context.Background()
+	products := testCatalog()
+	for i := range products {
+		products[i].CategoryID = 1 // phones
+	}
+	products[6].CategoryID, products[7].CategoryID = 2, 3
+
+	ix, _ := newTestIndex(t, DefaultConfig(0.7, 0.3), products)
+	res, err := ix.Search(ctx, "android phone", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cat, ok := BoostedCategory(res); ok {
+		t.Errorf("BoostedCategory = %d without CategoryBoost, want none", cat)
+	}
+
+	cfg := DefaultConfig(0.7, 0.3)
+	cfg.CategoryBoost = 0.1
+	ix, _ = newTestIndex(t, cfg, products)
+	res, err = ix.Search(ctx, "android phone", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, ok, err := ix.InferCategory(ctx, "android phone")
+	if err != nil || !ok || want != 1 {
+		t.Fatalf("InferCategory = %d, %v, %v; want phones", want, ok, err)
+	}
+	if got, ok := BoostedCategory(res); !ok || got != want {
+		t.Errorf("BoostedCategory = %d, %v; want %d", got, ok, want)
+	}
+}
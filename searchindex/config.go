@@ -0,0 +1,643 @@
+package searchindex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+// embedBatchSize is the effective Config.EmbedBatchSize.
+func (c Config) embedBatchSize() int {
+	if c.EmbedBatchSize > 0 {
+		return c.EmbedBatchSize
+	}
+	return MaxEmbedBatch
+}
+
+// maxInstructionLen caps Config.DocumentInstruction and
+// Config.QueryInstruction; model prompts are a sentence at most.
+const maxInstructionLen = 512
+
+// Config holds the tunables that shape scoring. It can be swapped at runtime
+// with SetConfig; apart from the weights, the zero value of every field keeps
+// the original behaviour.
+type Config struct {
+	SemanticWeight float64 `json:"semanticWeight"`
+	FuzzyWeight    float64 `json:"fuzzyWeight"`
+
+	// Weights sets the blend weight of any scoring signal by name
+	// (SignalSemantic, SignalFuzzy, SignalLexical), overriding
+	// SemanticWeight, FuzzyWeight and LexicalWeight for the names it
+	// lists. SearchResult.Why reports each signal under the same names.
+	Weights map[string]float64 `json:"weights"`
+
+	// MinFuzzyTokenLen drops query tokens shorter than this many characters
+	// from the fuzzy comparison; they are still embedded. 0 keeps every
+	// token. 2–3 stops tokens like "s" or "a" lifting unrelated products.
+	MinFuzzyTokenLen int `json:"minFuzzyTokenLen"`
+
+	// BrandBoost is added to the score of products whose Brand appears as a
+	// whole word (case-insensitively) in the query. 0 disables it.
+	BrandBoost float64 `json:"brandBoost"`
+
+	// CombinedBoost is added to the score of products whose title contains
+	// a model number from the query (a word with a digit, like "s23") along
+	// with another query word found in the title or brand, so "galaxy s23"
+	// puts the Galaxy S23 well above products matching only one of them. It
+	// stacks with BrandBoost. 0 disables it.
+	CombinedBoost float64 `json:"combinedBoost"`
+
+	// CategoryBoost is added to the score of products in the category
+	// inferred for the query (see Index.InferCategory), so "apple" leans
+	// towards phones in a phone-heavy result set. 0 disables it.
+	CategoryBoost float64 `json:"categoryBoost"`
+
+	// MaxDescriptionLen caps, in characters, how much of each description
+	// is embedded. Longer descriptions are cut at a word boundary; results
+	// still carry the full text. 0 embeds descriptions whole.
+	MaxDescriptionLen int `json:"maxDescriptionLen"`
+
+	// StripHTML indexes only the visible text of HTML descriptions: tags,
+	// comments and scripts are removed and entities decoded before
+	// embedding and fuzzy matching, and results carry the cleaned text.
+	// Leave it off for plain-text catalogs, where a "<" is just text.
+	StripHTML bool `json:"stripHTML"`
+
+	// EmbedTimeout bounds each embedding API call on its own, so one stuck
+	// product fails fast instead of eating the whole reindex deadline.
+	// 0 relies on the caller's context alone.
+	EmbedTimeout Duration `json:"embedTimeout"`
+
+	// EmbedBatchSize is how many texts go into one batch embedding call
+	// when indexing, up to MaxEmbedBatch. Larger batches mean fewer calls
+	// but bigger requests, which some models and payloads time out on. 0
+	// uses MaxEmbedBatch.
+	EmbedBatchSize int `json:"embedBatchSize"`
+
+	// SmallCorpus treats indexes of fewer products than this as small, as
+	// in local development or a demo: semantic similarities barely differ
+	// across a handful of products, and document frequencies say little,
+	// so MaxDocFreq is ignored and SmallCorpusWeights replace the entries
+	// of Weights they list. Index.SmallCorpus reports it. 0 disables it.
+	SmallCorpus        int                `json:"smallCorpus"`
+	SmallCorpusWeights map[string]float64 `json:"smallCorpusWeights"`
+
+	// PCADimensions reduces stored vectors to this many dimensions with
+	// PCA, for large catalogs on models without native reduction: at
+	// Rebuild the top principal components of the catalog's embeddings
+	// are fitted, and products and queries alike are projected onto them,
+	// so 768-dim vectors shrink to e.g. 128 (6x less memory and a faster
+	// scan). The cost is recall: whatever the discarded components told
+	// apart is lost, so near-duplicates and rare products suffer first;
+	// check relevance on real queries before shrinking far. Field vectors
+	// are reduced too, image vectors are not. Upsert and Sync keep the
+	// current projection; changing PCADimensions refits it on the next
+	// Rebuild, which re-embeds every product. A value at or above the
+	// model's dimension, or 0, stores full vectors.
+	PCADimensions int `json:"pcaDimensions"`
+
+	// DocumentInstruction and QueryInstruction are prepended to every
+	// product text and every query before embedding, for instruction-tuned
+	// models that expect a prompt such as "passage: " and "query: ". Use
+	// the exact strings the model recommends, trailing space included:
+	// products embedded under one instruction and queries under a
+	// mismatched one land in different regions of the space, and
+	// retrieval quality drops without any error. A changed
+	// DocumentInstruction re-embeds every product on the next Rebuild.
+	// Leave both empty for models that don't use instructions.
+	DocumentInstruction string `json:"documentInstruction"`
+	QueryInstruction    string `json:"queryInstruction"`
+
+	// FieldEmbeddings also embeds each product's title and description on
+	// their own at Rebuild, roughly tripling embedding calls. It takes
+	// effect on the next Rebuild.
+	FieldEmbeddings bool `json:"fieldEmbeddings"`
+	// QueryRouting compares queries that clearly target titles/brands or
+	// descriptions against that field's vector instead of the combined one.
+	// It needs FieldEmbeddings and falls back to combined scoring otherwise.
+	QueryRouting bool `json:"queryRouting"`
+
+	// StrictModelNumbers requires query words containing digits ("s23",
+	// "950") to appear verbatim in a field for it to earn fuzzy credit, so
+	// adjacent models like S22 and S23 don't match each other. Alphabetic
+	// words are still matched fuzzily.
+	StrictModelNumbers bool `json:"strictModelNumbers"`
+
+	// FuzzyCombined also fuzzy matches the query against the product's
+	// embedded text as a whole (title, brand, description and variants)
+	// and keeps the best of that and the single fields, so a query that
+	// spans fields, like brand plus model, can match across them. Word-
+	// order-free metrics (see FuzzyMetric and TokenSet) get the most out
+	// of it. Such matches report FieldCombined.
+	FuzzyCombined bool `json:"fuzzyCombined"`
+
+	// Calibration maps raw blended scores to a more query-independent
+	// confidence so clients can threshold on Score across queries. It
+	// changes what Score means and is opt-in:
+	//   ""         raw weighted blend (default)
+	//   "logistic" 1 / (1 + exp(-CalibrationSteepness*(score-CalibrationMidpoint)))
+	// Ranking within a query is unchanged either way.
+	Calibration          string  `json:"calibration"`
+	CalibrationMidpoint  float64 `json:"calibrationMidpoint"`
+	CalibrationSteepness float64 `json:"calibrationSteepness"`
+
+	// ContextWeight is how much SearchOptions.Context pulls the query
+	// embedding towards the session's recent queries, from 0 (ignored) to
+	// just under 1. It has no effect on searches without context, and is
+	// opt-in: DefaultConfig leaves it at 0.
+	ContextWeight float64 `json:"contextWeight"`
+
+	// StopWords are words that don't make a query on their own: a query of
+	// only these (and punctuation) fails with ErrTooGeneric. They are
+	// matched case-insensitively and still searched as part of longer
+	// queries. Empty only rejects queries without any letters or digits.
+	StopWords []string `json:"stopWords"`
+
+	// QueryCacheBytes bounds the memory, in bytes, of the LRU cache of
+	// query embeddings; least recently used queries are evicted past it.
+	// A 768-dim vector costs about 3 KiB. 0 disables the cache.
+	QueryCacheBytes int64 `json:"queryCacheBytes"`
+
+	// QueryHistorySize enables the query history behind SuggestQueries
+	// and bounds it to this many distinct queries. 0 disables it. The
+	// history holds raw user queries in memory, which may include names,
+	// addresses or other personal data, and suggests them to other users;
+	// QueryHistoryMinCount keeps one-off queries private.
+	// QueryHistoryHalfLife is how long until a query's popularity halves;
+	// 0 never decays it.
+	QueryHistorySize     int      `json:"queryHistorySize"`
+	QueryHistoryHalfLife Duration `json:"queryHistoryHalfLife"`
+	QueryHistoryMinCount int      `json:"queryHistoryMinCount"`
+
+	// AvailabilityBoost multiplies the score of products whose Status is in
+	// AvailableStatuses, e.g. 1.2, so in-stock items rank above otherwise
+	// equal out-of-stock ones without hiding them. 0 or 1 disables it.
+	AvailabilityBoost float64 `json:"availabilityBoost"`
+	AvailableStatuses []int   `json:"availableStatuses"`
+
+	// ConversionBoost adds ConversionBoost times a product's engagement
+	// rate, as set with Index.SetConversionRates, to its score, so
+	// products that get clicked or bought from search rank higher. The
+	// rates feed back on the ranking that produced them, so keep it small
+	// next to the blend weights. 0 disables it.
+	ConversionBoost float64 `json:"conversionBoost"`
+
+	// Tokenizer selects how text is split into words: "" for
+	// UnicodeTokenizer or "cjk" for CJKTokenizer, for catalogs with
+	// Chinese, Japanese or Korean text. JoinCompounds treats hyphenated and
+	// slashed words ("wi-fi") as one token. SplitScripts handles
+	// mixed-script text like "iphone手机" or "samsung телефон": a word ends
+	// where the writing system changes, and full-width Latin letters and
+	// digits ("ｉｐｈｏｎｅ") are folded to ASCII first. Query routing picks
+	// up a change on the next Rebuild.
+	Tokenizer     string `json:"tokenizer"`
+	JoinCompounds bool   `json:"joinCompounds"`
+	SplitScripts  bool   `json:"splitScripts"`
+
+	// PrefixWeight blends a prefix component into each field's fuzzy
+	// score: the share of query words that begin some word of the field,
+	// so partial queries like "sam" or "gal s2" fully credit "Samsung
+	// Galaxy S23". The field score becomes
+	// (1-PrefixWeight)*jaroWinkler + PrefixWeight*prefix. 0 disables it.
+	PrefixWeight float64 `json:"prefixWeight"`
+
+	// TitlePrefixWeight blends a title-prefix component into the title's
+	// fuzzy score: the longest run of query words that begin consecutive
+	// title words, as a share of the query, so "galaxy s2" scores "Galaxy
+	// S23" as a full match while "s2 galaxy" gets half. It is applied
+	// after PrefixWeight as
+	// (1-TitlePrefixWeight)*score + TitlePrefixWeight*titlePrefix.
+	// 0 disables it.
+	TitlePrefixWeight float64 `json:"titlePrefixWeight"`
+
+	// FieldNormalization is the pipeline the query and each field go
+	// through before fuzzy matching, keyed by field name (FieldTitle,
+	// FieldBrand, FieldDescription). Steps run in order: NormLowercase,
+	// NormFoldAccents ("café" matches "cafe"), NormStopWords (drops
+	// StopWords) and NormStem (drops English plural endings, so
+	// "batteries" matches "battery"). Fields without an entry are
+	// compared as they are. See DefaultFieldNormalization.
+	FieldNormalization map[string][]string `json:"fieldNormalization"`
+
+	// MatchTypeMargin is how far Why.Fuzzy and Why.Semantic must differ
+	// for SearchResult.MatchType to call a result "lexical" or "semantic"
+	// rather than "hybrid".
+	MatchTypeMargin float64 `json:"matchTypeMargin"`
+
+	// BrandRepeat is how many times the brand appears in the embedded
+	// text, weighting it more heavily in the combined vector than a single
+	// short token among the title and description would. 0 and 1 both
+	// embed it once. It takes effect on the next Rebuild.
+	BrandRepeat int `json:"brandRepeat"`
+
+	// FuzzyMetric picks the string similarity behind the fuzzy score:
+	// MetricJaroWinkler (default when empty), MetricLevenshtein,
+	// MetricNGram or MetricTokenSet. Highlighting always uses Jaro-Winkler.
+	FuzzyMetric string `json:"fuzzyMetric"`
+	// TokenSet combines the FuzzyMetric score, which follows word order,
+	// with the MetricTokenSet score, which doesn't, so "s23 galaxy"
+	// still matches "Galaxy S23": TokenSetMax takes the higher one and
+	// TokenSetBlend takes
+	// (1-TokenSetWeight)*FuzzyMetric + TokenSetWeight*tokenSet.
+	// "" uses FuzzyMetric alone, as does FuzzyMetric MetricTokenSet.
+	// DefaultConfig uses TokenSetMax.
+	TokenSet       string  `json:"tokenSet"`
+	TokenSetWeight float64 `json:"tokenSetWeight"`
+	// Blend picks how semantic and fuzzy scores combine: BlendWeighted
+	// (default when empty) or BlendRRF. RRF scores are small (about
+	// weight/60), so boosts and calibration tuned for the weighted sum
+	// need scaling down with it.
+	Blend string `json:"blend"`
+
+	// ImageWeight blends image similarity into the semantic score as
+	// (1-ImageWeight)*text + ImageWeight*image, for products with an image
+	// vector. It needs an ImageEmbedder (see SetImageEmbedder), costs one
+	// extra embedding call per search, and image vectors are only built
+	// at Rebuild. 0 disables it.
+	ImageWeight float64 `json:"imageWeight"`
+
+	// ExactMatchScore is the score given to products whose title or brand
+	// equals the query, ignoring case, spacing and punctuation, so a
+	// perfect match shows as e.g. 1.0 however the weights sum. It is
+	// applied last, after boosts and calibration. DefaultConfig uses 1;
+	// 0 disables it.
+	ExactMatchScore float64 `json:"exactMatchScore"`
+
+	// FuzzyOnlyFallback keeps search up when the query can't be embedded:
+	// results are ranked on the fuzzy (and lexical) signals alone, with a
+	// semantic score of 0, instead of failing with ErrEmbedding.
+	FuzzyOnlyFallback bool `json:"fuzzyOnlyFallback"`
+
+	// PartialMargin trades completeness for an answer when a search's
+	// context has a deadline: embedding calls are cut off PartialMargin
+	// before it, and scoring stops with half of PartialMargin left. A cut-off
+	// embedding drops its signal (the query's, leaving fuzzy and lexical
+	// scores) and a stopped scan ranks only the products it reached, in
+	// index order, so a relevant product late in the corpus can be missed.
+	// Such results have SearchResult.Partial set instead of the search
+	// failing. Size it to cover ranking and writing the response. 0
+	// disables it.
+	PartialMargin Duration `json:"partialMargin"`
+
+	// MinSemantic drops results whose semantic similarity is below it,
+	// however well they match fuzzily, so a typo-level match on an
+	// unrelated word can't surface a product that means something else.
+	// Unlike a floor on the blended score it only guards against fuzzy
+	// false positives. Exact matches are always kept. 0 disables it.
+	MinSemantic float64 `json:"minSemantic"`
+
+	// MinConfidence fails a search with ErrNoConfidentMatch when even its
+	// best result scores below it, after boosts and calibration, instead
+	// of returning whatever ranks highest for a query the catalog can't
+	// answer. Filters don't count: a filter that leaves nothing still
+	// gives an empty result. The right value depends on the weights and
+	// calibration. 0 disables it.
+	MinConfidence float64 `json:"minConfidence"`
+
+	// MinResults is how many results a filtered search should return
+	// before giving up on its filters: while fewer pass, the filters named
+	// in Relaxation are dropped one at a time, in order, and the search is
+	// retried; the results then list the dropped filters in
+	// SearchResult.Relaxed. Names are the Excluded constants for the
+	// minScore, price, recency, category and status filters, e.g.
+	// ["minScore", "price"]. Each retry rescores the corpus, reusing the
+	// cached query embedding when QueryCacheBytes allows. 0 disables it.
+	MinResults int      `json:"minResults"`
+	Relaxation []string `json:"relaxation"`
+
+	// ShuffleEpsilon randomizes the order of results whose scores are
+	// close, for exploration and fairness experiments. Sorted results are
+	// split into bands, each starting at the highest remaining score and
+	// holding every following result within ShuffleEpsilon of it, and each
+	// band is shuffled. Results never move between bands, so a result
+	// can't pass one scoring more than ShuffleEpsilon above it. The order
+	// is reproducible with SearchOptions.Seed. 0 disables it.
+	ShuffleEpsilon float64 `json:"shuffleEpsilon"`
+
+	// Tiebreakers order results with equal scores, applied in turn until
+	// one tells them apart: TieUpdated and TieCreated put newer products
+	// first, TieRating higher Product.Score, and TieID lower IDs. End the
+	// list with TieID for a fully deterministic order. Empty uses
+	// DefaultTiebreakers.
+	Tiebreakers []string `json:"tiebreakers"`
+
+	// MaxPerSeller caps how many results from one SellerID appear before
+	// other sellers' results: extra ones move below every result that fits
+	// the cap, so a prolific seller can't fill the top K. 0 disables it.
+	MaxPerSeller int `json:"maxPerSeller"`
+
+	// MaxDocFreq ignores query words found in more than this share of
+	// products (0–1) when fuzzy matching, so words like "phone" in a phone
+	// catalog don't dominate the fuzzy score; they are still embedded.
+	// Document frequencies are computed at Rebuild. 0 disables it.
+	MaxDocFreq float64 `json:"maxDocFreq"`
+
+	// Lexical adds a classic term-matching signal: LexicalBM25 scores
+	// exact query words by BM25 over title, brand and description,
+	// normalized per query so the best match is 1, and adds
+	// LexicalWeight times it to the blend. Set FuzzyWeight to 0 to use it
+	// instead of fuzzy matching. "" disables it.
+	Lexical       string  `json:"lexical"`
+	LexicalWeight float64 `json:"lexicalWeight"`
+}
+
+// Scoring signals, as named in Config.Weights and SearchResult.Why.
+const (
+	SignalSemantic = "semantic"
+	SignalFuzzy    = "fuzzy"
+	SignalLexical  = "lexical"
+)
+
+var signals = []string{SignalSemantic, SignalFuzzy, SignalLexical}
+
+// weights returns the blend weight of every signal.
+func (c Config) weights() map[string]float64 {
+	w := map[string]float64{
+		SignalSemantic: c.SemanticWeight,
+		SignalFuzzy:    c.FuzzyWeight,
+		SignalLexical:  c.LexicalWeight,
+	}
+	maps.Copy(w, c.Weights)
+	return w
+}
+
+// Calibration modes.
+const (
+	CalibrationNone     = ""
+	CalibrationLogistic = "logistic"
+)
+
+// Duration is a time.Duration that reads and writes JSON as a string such
+// as "10s", or as a number of nanoseconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("duration must be a string like \"10s\": %s", b)
+		}
+		*d = Duration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// DefaultConfig returns the configuration used by New. It shares no maps
+// or slices with the package defaults it starts from.
+func DefaultConfig(semanticWeight, fuzzyWeight float64) Config {
+	return Config{
+		SemanticWeight:       semanticWeight,
+		FuzzyWeight:          fuzzyWeight,
+		CalibrationMidpoint:  0.5,
+		CalibrationSteepness: 10,
+		ExactMatchScore:      1,
+		MatchTypeMargin:      0.1,
+		TokenSet:             TokenSetMax,
+		TokenSetWeight:       0.5,
+		StopWords:            DefaultStopWords,
+		FieldNormalization:   DefaultFieldNormalization,
+	}.Clone()
+}
+
+// Clone returns a deep copy of c, whose maps and slices can be changed,
+// or decoded into, without touching c's.
+func (c Config) Clone() Config {
+	c.Weights = maps.Clone(c.Weights)
+	c.SmallCorpusWeights = maps.Clone(c.SmallCorpusWeights)
+	c.StopWords = slices.Clone(c.StopWords)
+	c.AvailableStatuses = slices.Clone(c.AvailableStatuses)
+	c.Relaxation = slices.Clone(c.Relaxation)
+	c.Tiebreakers = slices.Clone(c.Tiebreakers)
+	if c.FieldNormalization != nil {
+		norms := make(map[string][]string, len(c.FieldNormalization))
+		for field, steps := range c.FieldNormalization {
+			norms[field] = slices.Clone(steps)
+		}
+		c.FieldNormalization = norms
+	}
+	return c
+}
+
+// Validate reports whether c can be applied to an Index.
+func (c Config) Validate() error {
+	if !validWeight(c.SemanticWeight) || !validWeight(c.FuzzyWeight) {
+		return fmt.Errorf("weights must be finite and non-negative (semantic=%v, fuzzy=%v)",
+			c.SemanticWeight, c.FuzzyWeight)
+	}
+	for name, w := range c.Weights {
+		if !slices.Contains(signals, name) {
+			return fmt.Errorf("unknown signal %q in weights (want one of %v)", name, signals)
+		}
+		if !validWeight(w) {
+			return fmt.Errorf("weight for %s must be finite and non-negative", name)
+		}
+	}
+	if c.SmallCorpus < 0 {
+		return errors.New("smallCorpus must be >= 0")
+	}
+	for name, w := range c.SmallCorpusWeights {
+		if !slices.Contains(signals, name) {
+			return fmt.Errorf("unknown signal %q in smallCorpusWeights (want one of %v)", name, signals)
+		}
+		if !validWeight(w) {
+			return fmt.Errorf("small-corpus weight for %s must be finite and non-negative", name)
+		}
+	}
+	if !validWeight(c.BrandBoost) {
+		return errors.New("brandBoost must be finite and non-negative")
+	}
+	if !validWeight(c.CategoryBoost) {
+		return errors.New("categoryBoost must be finite and non-negative")
+	}
+	if !validWeight(c.CombinedBoost) {
+		return errors.New("combinedBoost must be finite and non-negative")
+	}
+	if !validWeight(c.ConversionBoost) {
+		return errors.New("conversionBoost must be finite and non-negative")
+	}
+	if !validWeight(c.AvailabilityBoost) {
+		return errors.New("availabilityBoost must be finite and non-negative")
+	}
+	if c.MinFuzzyTokenLen < 0 {
+		return errors.New("minFuzzyTokenLen must be >= 0")
+	}
+	if c.BrandRepeat < 0 {
+		return errors.New("brandRepeat must be >= 0")
+	}
+	if c.MaxPerSeller < 0 {
+		return errors.New("maxPerSeller must be >= 0")
+	}
+	if c.MaxDescriptionLen < 0 {
+		return errors.New("maxDescriptionLen must be >= 0")
+	}
+	for name, s := range map[string]string{"documentInstruction": c.DocumentInstruction, "queryInstruction": c.QueryInstruction} {
+		if !utf8.ValidString(s) || len(s) > maxInstructionLen {
+			return fmt.Errorf("%s must be valid UTF-8 of at most %d bytes", name, maxInstructionLen)
+		}
+	}
+	if c.PCADimensions < 0 {
+		return errors.New("pcaDimensions must be >= 0")
+	}
+	if c.EmbedBatchSize < 0 || c.EmbedBatchSize > MaxEmbedBatch {
+		return fmt.Errorf("embedBatchSize must be in [0, %d]", MaxEmbedBatch)
+	}
+	if c.EmbedTimeout < 0 {
+		return errors.New("embedTimeout must be >= 0")
+	}
+	if c.QueryCacheBytes < 0 {
+		return errors.New("queryCacheBytes must be >= 0")
+	}
+	if c.QueryHistorySize < 0 || c.QueryHistoryHalfLife < 0 || c.QueryHistoryMinCount < 0 {
+		return errors.New("queryHistorySize, queryHistoryHalfLife and queryHistoryMinCount must be >= 0")
+	}
+	if !validWeight(c.MatchTypeMargin) {
+		return errors.New("matchTypeMargin must be finite and non-negative")
+	}
+	if c.MinSemantic < 0 || c.MinSemantic > 1 || math.IsNaN(c.MinSemantic) {
+		return errors.New("minSemantic must be in [0, 1]")
+	}
+	if c.PartialMargin < 0 {
+		return errors.New("partialMargin must be >= 0")
+	}
+	if !validWeight(c.MinConfidence) {
+		return errors.New("minConfidence must be finite and non-negative")
+	}
+	if c.MinResults < 0 {
+		return errors.New("minResults must be >= 0")
+	}
+	for _, step := range c.Relaxation {
+		if !slices.Contains(relaxable, step) {
+			return fmt.Errorf("unknown relaxation step %q (want one of %v)", step, relaxable)
+		}
+	}
+	for _, t := range c.Tiebreakers {
+		if !slices.Contains(tiebreakers, t) {
+			return fmt.Errorf("unknown tiebreaker %q (want one of %v)", t, tiebreakers)
+		}
+	}
+	if !validWeight(c.ShuffleEpsilon) {
+		return errors.New("shuffleEpsilon must be finite and non-negative")
+	}
+	if !validWeight(c.ExactMatchScore) {
+		return errors.New("exactMatchScore must be finite and non-negative")
+	}
+	if c.Lexical != LexicalNone && c.Lexical != LexicalBM25 {
+		return fmt.Errorf("unknown lexical scorer %q (want %s)", c.Lexical, LexicalBM25)
+	}
+	if !validWeight(c.LexicalWeight) {
+		return errors.New("lexicalWeight must be finite and non-negative")
+	}
+	if !(c.MaxDocFreq >= 0 && c.MaxDocFreq <= 1) {
+		return errors.New("maxDocFreq must be in [0, 1]")
+	}
+	if !(c.ImageWeight >= 0 && c.ImageWeight <= 1) {
+		return errors.New("imageWeight must be in [0, 1]")
+	}
+	if !(c.PrefixWeight >= 0 && c.PrefixWeight <= 1) {
+		return errors.New("prefixWeight must be in [0, 1]")
+	}
+	for field, steps := range c.FieldNormalization {
+		if !slices.Contains(fuzzyFields, field) {
+			return fmt.Errorf("unknown field %q in fieldNormalization (want one of %v)", field, fuzzyFields)
+		}
+		for _, step := range steps {
+			if !slices.Contains(normSteps, step) {
+				return fmt.Errorf("unknown normalization step %q for %s (want one of %v)", step, field, normSteps)
+			}
+		}
+	}
+	if !(c.TitlePrefixWeight >= 0 && c.TitlePrefixWeight <= 1) {
+		return errors.New("titlePrefixWeight must be in [0, 1]")
+	}
+	if !(c.ContextWeight >= 0 && c.ContextWeight < 1) {
+		return errors.New("contextWeight must be in [0, 1)")
+	}
+	if c.Tokenizer != TokenizerUnicode && c.Tokenizer != TokenizerCJK {
+		return fmt.Errorf("unknown tokenizer %q", c.Tokenizer)
+	}
+	if _, err := metricFunc(c.FuzzyMetric, nil); err != nil {
+		return err
+	}
+	if c.TokenSet != "" && c.TokenSet != TokenSetMax && c.TokenSet != TokenSetBlend {
+		return fmt.Errorf("unknown tokenSet %q (want %s or %s)", c.TokenSet, TokenSetMax, TokenSetBlend)
+	}
+	if !(c.TokenSetWeight >= 0 && c.TokenSetWeight <= 1) {
+		return errors.New("tokenSetWeight must be in [0, 1]")
+	}
+	if c.Blend != "" && c.Blend != BlendWeighted && c.Blend != BlendRRF {
+		return fmt.Errorf("unknown blend %q (want %s or %s)", c.Blend, BlendWeighted, BlendRRF)
+	}
+	switch c.Calibration {
+	case CalibrationNone:
+	case CalibrationLogistic:
+		if !(c.CalibrationSteepness > 0) || math.IsInf(c.CalibrationSteepness, 0) || math.IsNaN(c.CalibrationMidpoint) {
+			return errors.New("logistic calibration needs a positive calibrationSteepness and a calibrationMidpoint")
+		}
+	default:
+		return fmt.Errorf("unknown calibration %q", c.Calibration)
+	}
+	return nil
+}
+
+func validWeight(w float64) bool {
+	return w >= 0 && !math.IsInf(w, 0) && !math.IsNaN(w)
+}
+
+// Config returns a deep copy of the active configuration, safe to modify
+// and pass to SetConfig.
+func (ix *Index) Config() Config {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.cfg.Clone()
+}
+
+// ConfigHash returns a short fingerprint of the active configuration, the
+// same for equal configs. Caches of search results can key on it as well
+// as Generation, so they never serve rankings from a replaced config.
+func (ix *Index) ConfigHash() string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.cfgHash
+}
+
+// hash fingerprints c for ConfigHash. Maps encode with sorted keys, so
+// equal configs hash equally.
+func (c Config) hash() string {
+	b, _ := json.Marshal(c)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SetConfig validates c and, if it is valid, makes it the active
+// configuration and bumps Generation, since almost any setting can change
+// rankings. An invalid config leaves the previous one in place.
+func (ix *Index) SetConfig(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	c = c.Clone()
+	h := c.hash()
+	ix.mu.Lock()
+	ix.cfg, ix.cfgHash = c, h
+	ix.generation++
+	ix.mu.Unlock()
+	return nil
+}
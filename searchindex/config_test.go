@@ -0,0 +1,60 @@
+package searchindex
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSetConfigBumpsGeneration(t *testing.T) {
+	ctx := context.Background()
+	ix, _ := newTestIndex(t, DefaultConfig(0.7, 0.3), testCatalog())
+	_, next, err := ix.SearchPage(ctx, "phone", 2, "", SearchOptions{})
+	if err != nil || next == "" {
+		t.Fatalf("first page: next %q, err %v", next, err)
+	}
+
+	gen := ix.Generation()
+	cfg := ix.Config()
+	cfg.FuzzyWeight = 0.5
+	if err := ix.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := ix.Generation(); got <= gen {
+		t.Errorf("Generation = %d after SetConfig, want above %d", got, gen)
+	}
+	if _, _, err := ix.SearchPage(ctx, "phone", 2, next, SearchOptions{}); !errors.Is(err, ErrStaleCursor) {
+		t.Errorf("cursor from before SetConfig: %v, want ErrStaleCursor", err)
+	}
+
+	gen = ix.Generation()
+	cfg.SemanticWeight = -1
+	if err := ix.SetConfig(cfg); err == nil {
+		t.Fatal("SetConfig accepted a negative weight")
+	}
+	if got := ix.Generation(); got != gen {
+		t.Errorf("Generation = %d after a rejected SetConfig, want %d", got, gen)
+	}
+}
+
+func TestConfigHashFollowsConfig(t *testing.T) {
+	ix, _ := newTestIndex(t, DefaultConfig(0.7, 0.3), testCatalog())
+	h := ix.ConfigHash()
+	if h == "" {
+		t.Fatal("empty ConfigHash")
+	}
+	if err := ix.SetConfig(ix.Config()); err != nil {
+		t.Fatal(err)
+	}
+	if got := ix.ConfigHash(); got != h {
+		t.Errorf("ConfigHash = %q after setting an equal config, want %q", got, h)
+	}
+	cfg := ix.Config()
+	cfg.Weights = map[string]float64{SignalFuzzy: 0.9}
+	if err := ix.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := ix.ConfigHash(); got == h {
+		t.Errorf("ConfigHash unchanged after changing weights")
+	}
+}
@@ -0,0 +1,37 @@
+package searchindex
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSessionContextIsOptIn(t *testing.T) {
+	ctx := context.Background()
+	session := SearchOptions{Context: []string{"running shoes", "trainers"}}
+	semantic := func(ix *Index, opts SearchOptions) float64 {
+		t.Helper()
+		res, err := ix.SearchWithOptions(ctx, "nike", 0, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range res {
+			if r.Product.ID == 7 {
+				return r.Why[SignalSemantic]
+			}
+		}
+		t.Fatal("product 7 not returned")
+		return 0
+	}
+
+	ix, _ := newTestIndex(t, DefaultConfig(0.7, 0.3), testCatalog())
+	if plain, withCtx := semantic(ix, SearchOptions{}), semantic(ix, session); plain != withCtx {
+		t.Errorf("default config: semantic %v with context, want %v as without", withCtx, plain)
+	}
+
+	cfg := DefaultConfig(0.7, 0.3)
+	cfg.ContextWeight = 0.3
+	ix, _ = newTestIndex(t, cfg, testCatalog())
+	if plain, withCtx := semantic(ix, SearchOptions{}), semantic(ix, session); withCtx <= plain {
+		t.Errorf("ContextWeight 0.3: semantic %v with context, want above %v without", withCtx, plain)
+	}
+}
@@ -0,0 +1,23 @@
+package searchindex
+
+import "math"
+
+// SetConversionRates replaces the per-product engagement rates behind
+// Config.ConversionBoost, keyed by Product.ID (see IDFor for external
+// IDs): click-through or conversion rates in [0, 1], e.g. computed from
+// search analytics. Values outside that range are clamped and NaN is
+// dropped. Products without a rate get no boost. It takes effect on the
+// next search without a rebuild and, since it changes rankings, advances
+// the Generation; nil clears the rates.
+func (ix *Index) SetConversionRates(rates map[uint]float64) {
+	clean := make(map[uint]float64, len(rates))
+	for id, r := range rates {
+		if !math.IsNaN(r) {
+			clean[id] = min(max(r, 0), 1)
+		}
+	}
+	ix.mu.Lock()
+	ix.rates = clean
+	ix.generation++
+	ix.mu.Unlock()
+}
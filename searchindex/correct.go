@@ -0,0 +1,47 @@
+package searchindex
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// correctMinLen is the shortest query word CorrectQuery will change;
+	// shorter words have too many close neighbours to guess from.
+	correctMinLen = 4
+	// correctMinSim is how similar (Jaro-Winkler) a vocabulary word must be
+	// to replace a query word.
+	correctMinSim = 0.9
+)
+
+// CorrectQuery is a local spelling correction for when the LLM rewriter is
+// unavailable: each query word that isn't in the indexed vocabulary is
+// replaced by the most similar word that is, if one is close enough. Words
+// with digits (model numbers) and short words are left alone. It reports
+// whether anything changed. No API calls are made.
+func (ix *Index) CorrectQuery(q string) (string, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	ws := words(ix.cfg.tokenizer(), q)
+	changed := false
+	for i, w := range ws {
+		if _, ok := ix.vocab[w]; ok || utf8.RuneCountInString(w) < correctMinLen ||
+			strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+			continue
+		}
+		best, bestSim := "", correctMinSim
+		for v := range ix.vocab {
+			if s := jaroWinkler(w, v); s > bestSim || s == bestSim && best != "" && v < best {
+				best, bestSim = v, s
+			}
+		}
+		if best != "" {
+			ws[i], changed = best, true
+		}
+	}
+	if !changed {
+		return q, false
+	}
+	return strings.Join(ws, " "), true
+}
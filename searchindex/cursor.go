@@ -0,0 +1,105 @@
+package searchindex
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Cursor marks where a page of results ended, so the next request can
+// resume after it. Its encoded form (String) is opaque to clients: they
+// pass back what they were given and must not build or inspect one.
+//
+// A cursor is only good for the index generation it was issued at. Once a
+// reindex, sync, config or conversion-rate change bumps the generation,
+// resuming fails with ErrStaleCursor and the client restarts from the
+// first page, rather than silently skipping or repeating products.
+type Cursor struct {
+	Query      string `json:"q"`
+	Generation uint64 `json:"g"`
+	// Offset counts the results returned so far; ID and Score are the
+	// last of them, checked on resume.
+	Offset int     `json:"o"`
+	ID     uint    `json:"id"`
+	Score  float64 `json:"s"`
+}
+
+// String encodes c for handing to a client.
+func (c Cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor decodes a cursor made by Cursor.String.
+func ParseCursor(s string) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.Offset < 1 {
+		return Cursor{}, ErrBadCursor
+	}
+	return c, nil
+}
+
+// NextCursor returns the cursor for resuming after page, a page of
+// results for query at generation gen that followed offset earlier ones.
+func NextCursor(query string, gen uint64, offset int, page []SearchResult) Cursor {
+	last := page[len(page)-1]
+	return Cursor{Query: query, Generation: gen, Offset: offset + len(page), ID: last.Product.ID, Score: last.Score}
+}
+
+// Resume returns the part of results, the ranking for query at generation
+// gen, that comes after c. It fails with ErrBadCursor if c belongs to
+// another query, and with ErrStaleCursor if the generation has moved on
+// or the ranking no longer matches where c left off.
+func Resume(results []SearchResult, c Cursor, query string, gen uint64) ([]SearchResult, error) {
+	if c.Query != query {
+		return nil, ErrBadCursor
+	}
+	if c.Generation != gen || c.Offset > len(results) {
+		return nil, ErrStaleCursor
+	}
+	if last := results[c.Offset-1]; last.Product.ID != c.ID || last.Score != c.Score {
+		return nil, ErrStaleCursor
+	}
+	return results[c.Offset:], nil
+}
+
+// SearchPage runs SearchWithOptions one page at a time. cursor is "" for
+// the first page, or the next cursor of the page before; next is "" once
+// the results run out. opts must be the same on every page. pageSize <= 0
+// returns every remaining result in one page; it is the only page size
+// allowed with opts.Sort, which fails with ErrSortedCursor otherwise.
+func (ix *Index) SearchPage(ctx context.Context, query string, pageSize int, cursor string, opts SearchOptions) (page []SearchResult, next string, err error) {
+	if opts.Sort != "" && (pageSize > 0 || cursor != "") {
+		return nil, "", ErrSortedCursor
+	}
+	var c Cursor
+	if cursor != "" {
+		if c, err = ParseCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	gen := ix.Generation()
+	if cursor != "" && c.Generation != gen {
+		return nil, "", ErrStaleCursor
+	}
+	// One extra result tells whether there is a next page.
+	topK := 0
+	if pageSize > 0 {
+		topK = c.Offset + pageSize + 1
+	}
+	results, err := ix.SearchWithOptions(ctx, query, topK, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	if cursor != "" {
+		if results, err = Resume(results, c, query, gen); err != nil {
+			return nil, "", err
+		}
+	}
+	if pageSize <= 0 || len(results) <= pageSize {
+		return results, "", nil
+	}
+	page = results[:pageSize]
+	return page, NextCursor(query, gen, c.Offset, page).String(), nil
+}
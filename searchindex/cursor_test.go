@@ -0,0 +1,57 @@
+package searchindex
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSearchPageCoversRanking(t *testing.T) {
+	ctx := context.Background()
+	ix, _ := newTestIndex(t, DefaultConfig(0.7, 0.3), testCatalog())
+	all, err := ix.Search(ctx, "phone camera", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paged []SearchResult
+	cursor := ""
+	for {
+		page, next, err := ix.SearchPage(ctx, "phone camera", 3, cursor, SearchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	ids := func(rs []SearchResult) []uint {
+		out := make([]uint, len(rs))
+		for i, r := range rs {
+			out[i] = r.Product.ID
+		}
+		return out
+	}
+	if !slices.Equal(ids(paged), ids(all)) {
+		t.Errorf("pages gave %v, want %v", ids(paged), ids(all))
+	}
+}
+
+func TestSearchPageRejectsSort(t *testing.T) {
+	ctx := context.Background()
+	ix, _ := newTestIndex(t, DefaultConfig(0.7, 0.3), testCatalog())
+	opts := SearchOptions{Sort: "price"}
+	if _, _, err := ix.SearchPage(ctx, "phone", 3, "", opts); !errors.Is(err, ErrSortedCursor) {
+		t.Errorf("sorted page: err %v, want ErrSortedCursor", err)
+	}
+	page, next, err := ix.SearchPage(ctx, "phone", 0, "", opts)
+	if err != nil || next != "" {
+		t.Fatalf("sorted single page: next %q, err %v", next, err)
+	}
+	if !slices.IsSortedFunc(page, func(a, b SearchResult) int { return cmp.Compare(a.Product.Price, b.Product.Price) }) {
+		t.Errorf("single page isn't sorted by price")
+	}
+}
@@ -0,0 +1,39 @@
+package searchindex
+
+import "strings"
+
+// buildDocFreq counts, for every word, how many products contain it in
+// their title, brand or description.
+func buildDocFreq(docs []productDoc, tok Tokenizer) map[string]int {
+	df := map[string]int{}
+	for _, d := range docs {
+		seen := map[string]bool{}
+		for _, w := range words(tok, d.P.Title+" "+d.P.Brand+" "+d.P.Description) {
+			if !seen[w] {
+				seen[w] = true
+				df[w]++
+			}
+		}
+	}
+	return df
+}
+
+// dropCommonTokens removes words found in more than maxDF of n products
+// from the fuzzy query, e.g. "phone" in a phone catalog, so distinctive
+// words decide the fuzzy score. If every word is common, q is returned
+// unchanged rather than leaving nothing to match.
+func dropCommonTokens(tok Tokenizer, q string, df map[string]int, n int, maxDF float64) string {
+	if n == 0 {
+		return q
+	}
+	var kept []string
+	for _, w := range words(tok, q) {
+		if float64(df[w])/float64(n) <= maxDF {
+			kept = append(kept, w)
+		}
+	}
+	if len(kept) == 0 {
+		return q
+	}
+	return strings.Join(kept, " ")
+}
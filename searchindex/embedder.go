@@ -0,0 +1,192 @@
+package searchindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	genai "github.com/google/generative-ai-go/genai"
+	unified "google.golang.org/genai"
+)
+
+// Embedder turns text into an embedding vector. Implementations wrap a
+// specific SDK so the index doesn't depend on one.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// BatchEmbedder is implemented by Embedders that can embed several texts in
+// one API call. Rebuild uses it when available.
+type BatchEmbedder interface {
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// legacyEmbedder uses the deprecated github.com/google/generative-ai-go SDK.
+type legacyEmbedder struct {
+	em *genai.EmbeddingModel
+}
+
+// NewLegacyEmbedder returns an Embedder backed by the legacy SDK client.
+func NewLegacyEmbedder(client *genai.Client, modelName string) Embedder {
+	return legacyEmbedder{em: client.EmbeddingModel(modelName)}
+}
+
+func (e legacyEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	resp, err := e.em.EmbedContent(ctx, genai.Text(text))
+	if err != nil {
+		return nil, err
+	}
+	if resp.Embedding == nil {
+		return nil, errors.New("empty embedding response")
+	}
+	return resp.Embedding.Values, nil
+}
+
+func (e legacyEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	b := e.em.NewBatch()
+	for _, t := range texts {
+		b.AddContent(genai.Text(t))
+	}
+	resp, err := e.em.BatchEmbedContents(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]float32, len(resp.Embeddings))
+	for i, emb := range resp.Embeddings {
+		if emb != nil {
+			out[i] = emb.Values
+		}
+	}
+	return out, nil
+}
+
+// unifiedEmbedder uses the google.golang.org/genai SDK.
+type unifiedEmbedder struct {
+	client    *unified.Client
+	modelName string
+}
+
+// NewUnifiedEmbedder returns an Embedder backed by the google.golang.org/genai
+// client.
+func NewUnifiedEmbedder(client *unified.Client, modelName string) Embedder {
+	return unifiedEmbedder{client: client, modelName: modelName}
+}
+
+func (e unifiedEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	resp, err := e.client.Models.EmbedContent(ctx, e.modelName, unified.Text(text), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) == 0 || resp.Embeddings[0] == nil {
+		return nil, errors.New("empty embedding response")
+	}
+	return resp.Embeddings[0].Values, nil
+}
+
+func (e unifiedEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	contents := make([]*unified.Content, len(texts))
+	for i, t := range texts {
+		contents[i] = unified.NewContentFromText(t, unified.RoleUser)
+	}
+	resp, err := e.client.Models.EmbedContent(ctx, e.modelName, contents, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]float32, len(resp.Embeddings))
+	for i, emb := range resp.Embeddings {
+		if emb != nil {
+			out[i] = emb.Values
+		}
+	}
+	return out, nil
+}
+
+// FallbackEmbedder tries each Embedder in order until one succeeds, e.g. the
+// same model through a second API key or region. Stored and query vectors
+// must come from the same model to be comparable, so only chain embedders
+// of one model: vectors from different models don't share a space even
+// when their dimensions agree. As a guard, a vector whose length differs
+// from the first one this embedder returned counts as a failure.
+type FallbackEmbedder struct {
+	embedders []Embedder
+	dim       atomic.Int64
+}
+
+// NewFallbackEmbedder returns an Embedder that tries ems in order.
+func NewFallbackEmbedder(ems ...Embedder) *FallbackEmbedder {
+	return &FallbackEmbedder{embedders: ems}
+}
+
+func (f *FallbackEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	var errs []error
+	for i, e := range f.embedders {
+		vec, err := e.Embed(ctx, text)
+		if err == nil {
+			err = f.checkDim(len(vec))
+		}
+		if err == nil {
+			return vec, nil
+		}
+		errs = append(errs, fmt.Errorf("embedder %d: %w", i, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no embedders configured")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// EmbedBatch batches through each embedder that supports it and embeds
+// one text at a time through the others.
+func (f *FallbackEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	var errs []error
+	for i, e := range f.embedders {
+		vecs, err := embedAll(ctx, e, texts)
+		for _, v := range vecs {
+			if err != nil {
+				break
+			}
+			err = f.checkDim(len(v))
+		}
+		if err == nil {
+			return vecs, nil
+		}
+		errs = append(errs, fmt.Errorf("embedder %d: %w", i, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no embedders configured")
+	}
+	return nil, errors.Join(errs...)
+}
+
+func embedAll(ctx context.Context, e Embedder, texts []string) ([][]float32, error) {
+	if be, ok := e.(BatchEmbedder); ok {
+		return be.EmbedBatch(ctx, texts)
+	}
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		v, err := e.Embed(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// checkDim records the first vector length seen and rejects any other.
+func (f *FallbackEmbedder) checkDim(n int) error {
+	if f.dim.CompareAndSwap(0, int64(n)) {
+		return nil
+	}
+	if want := f.dim.Load(); int64(n) != want {
+		return fmt.Errorf("%w: got %d dimensions, want %d", ErrDimensionMismatch, n, want)
+	}
+	return nil
+}
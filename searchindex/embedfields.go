@@ -0,0 +1,54 @@
+package searchindex
+
+import "slices"
+
+// Fields a FieldSelector can put in a product's embedded text besides the
+// title, which is always embedded.
+const (
+	EmbedBrand       = "brand"
+	EmbedDescription = "description"
+	EmbedVariants    = "variants"
+)
+
+// FieldSelector picks which fields go into a product's embedded text
+// (SearchText), so embedding budget can go to the products that matter:
+// e.g. full text for best sellers and titles only for the long tail. It
+// returns any of the Embed constants; nil embeds every field. Fuzzy and
+// lexical matching still see every field.
+type FieldSelector func(Product) []string
+
+// SetFieldSelector sets the FieldSelector used from the next Rebuild,
+// Upsert or Sync on; nil, the default, embeds every field. Products whose
+// embedded text changes as a result are re-embedded.
+func (ix *Index) SetFieldSelector(f FieldSelector) {
+	ix.mu.Lock()
+	ix.fieldSel = f
+	ix.mu.Unlock()
+}
+
+// ScoreFieldSelector embeds every field of products with a Score of at
+// least minScore, and only fields of the rest.
+func ScoreFieldSelector(minScore int, fields ...string) FieldSelector {
+	return func(p Product) []string {
+		if p.Score >= minScore {
+			return nil
+		}
+		if fields == nil {
+			// Title only; nil would mean every field.
+			return []string{}
+		}
+		return fields
+	}
+}
+
+// embeds reports whether sel embeds field of p.
+func (sel FieldSelector) embeds(p Product) func(field string) bool {
+	if sel == nil {
+		return func(string) bool { return true }
+	}
+	fields := sel(p)
+	if fields == nil {
+		return func(string) bool { return true }
+	}
+	return func(field string) bool { return slices.Contains(fields, field) }
+}
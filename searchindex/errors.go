@@ -0,0 +1,62 @@
+package searchindex
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrEmptyQuery is returned when a search query is blank.
+	ErrEmptyQuery = errors.New("searchindex: empty query")
+	// ErrTooGeneric is returned when a query is only stop words or
+	// punctuation; see Config.StopWords.
+	ErrTooGeneric = errors.New("searchindex: query too generic")
+	// ErrNoConfidentMatch is returned when no product scores at least
+	// Config.MinConfidence, i.e. the query matches nothing in the catalog
+	// well enough to show.
+	ErrNoConfidentMatch = errors.New("searchindex: no confident matches")
+	// ErrEmbedding matches any failed embedding API call; see EmbeddingError.
+	ErrEmbedding = errors.New("searchindex: embedding failed")
+	// ErrDimensionMismatch is returned when vectors of different lengths
+	// would be compared, e.g. after switching embedding models.
+	ErrDimensionMismatch = errors.New("searchindex: embedding dimension mismatch")
+	// ErrIndexEmpty is returned when searching before anything is indexed.
+	ErrIndexEmpty = errors.New("searchindex: index is empty")
+	// ErrUnknownFacet is returned by FacetValues for unsupported fields.
+	ErrUnknownFacet = errors.New("searchindex: unknown facet field")
+	// ErrSnapshotMismatch is returned by Load for snapshots built with a
+	// different embedding model or in an incompatible layout.
+	ErrSnapshotMismatch = errors.New("searchindex: snapshot does not match index")
+	// ErrUnknownSortField is returned for a sort on a field that isn't
+	// built in or registered; see Index.RegisterSortField.
+	ErrUnknownSortField = errors.New("searchindex: unknown sort field")
+	// ErrBadCursor is returned for a pagination cursor that doesn't decode
+	// or belongs to a different query.
+	ErrBadCursor = errors.New("searchindex: invalid cursor")
+	// ErrStaleCursor is returned for a pagination cursor issued before the
+	// index changed; the client should restart from the first page.
+	ErrStaleCursor = errors.New("searchindex: stale cursor")
+	// ErrSortedCursor is returned when paging results that are sorted by
+	// a product field: a sort only orders one page, so pages would
+	// overlap and skip products.
+	ErrSortedCursor = errors.New("searchindex: cursor can't be combined with sort")
+	// ErrNotIndexed is returned when a product ID isn't in the index.
+	ErrNotIndexed = errors.New("searchindex: product not indexed")
+)
+
+// EmbeddingError reports a failed call to the embedding API. It matches
+// ErrEmbedding as well as the underlying SDK error with errors.Is.
+type EmbeddingError struct {
+	// ProductID is the product being embedded, or 0 for a query.
+	ProductID uint
+	Err       error
+}
+
+func (e *EmbeddingError) Error() string {
+	if e.ProductID == 0 {
+		return fmt.Sprintf("embed query: %v", e.Err)
+	}
+	return fmt.Sprintf("embed product %d: %v", e.ProductID, e.Err)
+}
+
+func (e *EmbeddingError) Unwrap() []error { return []error{ErrEmbedding, e.Err} }
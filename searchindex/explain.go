@@ -0,0 +1,86 @@
+package searchindex
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// strength describes a signal score in words for explanations.
+func strength(s float64) string {
+	switch {
+	case s >= 0.8:
+		return "strong"
+	case s >= 0.5:
+		return "moderate"
+	}
+	return "weak"
+}
+
+// explain describes in plain English why r scored as it did, e.g.
+// "Matched 'iphone' in title (strong); semantically similar to query
+// (moderate); brand boost applied."
+func explain(r SearchResult) string {
+	var parts []string
+	if r.ExactMatch {
+		parts = append(parts, "exact title or brand match")
+	}
+	if fuz := r.Why[SignalFuzzy]; r.Field != "" && fuz > 0 {
+		if h := r.Highlight; h != nil {
+			text := []rune(fieldText(r.Product, r.Field))
+			parts = append(parts, fmt.Sprintf("matched '%s' in %s (%s)", string(text[h.Start:h.End]), r.Field, strength(fuz)))
+		} else {
+			parts = append(parts, fmt.Sprintf("closest text match in %s (%s)", r.Field, strength(fuz)))
+		}
+	}
+	if sem, ok := r.Why[SignalSemantic]; ok {
+		parts = append(parts, fmt.Sprintf("semantically similar to query (%s)", strength(sem)))
+	}
+	if lex, ok := r.Why[SignalLexical]; ok && lex > 0 {
+		parts = append(parts, fmt.Sprintf("keyword relevance (%s)", strength(lex)))
+	}
+	if r.Variant != nil {
+		parts = append(parts, "query names variant "+r.Variant.SKU)
+	}
+	boosts := make([]string, 0, len(r.Boosts))
+	for name := range r.Boosts {
+		boosts = append(boosts, name)
+	}
+	slices.Sort(boosts)
+	for _, name := range boosts {
+		parts = append(parts, name+" boost applied")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	s := strings.Join(parts, "; ") + "."
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// Rounded returns a copy of r with Score, Why and Boosts rounded to digits
+// decimal places, for responses that don't need full float precision. It
+// is meant for output only; rank before rounding. digits <= 0 returns r
+// unchanged.
+func (r SearchResult) Rounded(digits int) SearchResult {
+	if digits <= 0 {
+		return r
+	}
+	p := math.Pow10(digits)
+	round := func(v float64) float64 { return math.Round(v*p) / p }
+	r.Score = round(r.Score)
+	r.Why = roundMap(r.Why, round)
+	r.Boosts = roundMap(r.Boosts, round)
+	return r
+}
+
+func roundMap(m map[string]float64, round func(float64) float64) map[string]float64 {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]float64, len(m))
+	for k, v := range m {
+		out[k] = round(v)
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package searchindex
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// VectorRecord is one line of ExportVectors: the shape most vector
+// databases (pgvector, Qdrant, Pinecone) bulk-import, an ID, a vector and
+// a flat metadata object.
+type VectorRecord struct {
+	ID       uint           `json:"id"`
+	Vector   []float32      `json:"vector"`
+	Metadata VectorMetadata `json:"metadata"`
+}
+
+// VectorMetadata is the product data exported with its vector, enough to
+// filter on and display without going back to the catalog.
+type VectorMetadata struct {
+	ExternalID string  `json:"externalId,omitempty"`
+	Title      string  `json:"title"`
+	Brand      string  `json:"brand,omitempty"`
+	CategoryID uint    `json:"categoryId,omitempty"`
+	SellerID   uint    `json:"sellerId,omitempty"`
+	Status     int     `json:"status"`
+	Price      float64 `json:"price"`
+	Model      string  `json:"model"`
+	SearchText string  `json:"searchText"`
+}
+
+// ExportVectors writes every indexed product's combined vector to w as
+// JSON Lines, one VectorRecord per line, for migrating to a dedicated
+// vector database without re-embedding. It writes the corpus as of the
+// call, record by record, without holding the index lock, so a large
+// export neither blocks reindexing nor buffers the catalog.
+//
+// Vectors are stored unit length, so cosine and dot-product distance agree
+// in the target database. With Config.PCADimensions they are the reduced
+// vectors, and queries must be projected the same way to match them.
+func (ix *Index) ExportVectors(w io.Writer) error {
+	ix.mu.RLock()
+	docs, model := ix.docs, ix.modelName
+	ix.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, d := range docs {
+		p := d.P
+		rec := VectorRecord{
+			ID:     p.ID,
+			Vector: d.Embedding,
+			Metadata: VectorMetadata{
+				ExternalID: p.ExternalID,
+				Title:      p.Title,
+				Brand:      p.Brand,
+				CategoryID: p.CategoryID,
+				SellerID:   p.SellerID,
+				Status:     p.Status,
+				Price:      p.Price,
+				Model:      model,
+				SearchText: d.SearchText,
+			},
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
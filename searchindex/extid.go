@@ -0,0 +1,77 @@
+package searchindex
+
+import "math"
+
+// ExternalIDBase is the first internal ID assigned to products keyed by
+// Product.ExternalID. Numeric product IDs must stay below it.
+const ExternalIDBase uint = math.MaxUint/2 + 1
+
+// externalIDs maps string product keys to the internal IDs standing in for
+// them. Assignments live as long as the Index, so a product keeps its ID
+// across rebuilds.
+type externalIDs struct {
+	ids  map[string]uint
+	next uint
+}
+
+// withInternalIDs returns ps with an internal ID set on every product that
+// has an ExternalID and no ID. ps itself is not modified.
+func (ix *Index) withInternalIDs(ps []Product) []Product {
+	var out []Product
+	for i, p := range ps {
+		if p.ID != 0 || p.ExternalID == "" {
+			continue
+		}
+		if out == nil {
+			out = append([]Product(nil), ps...)
+		}
+		out[i].ID = ix.internalID(p.ExternalID)
+	}
+	if out == nil {
+		return ps
+	}
+	return out
+}
+
+func (ix *Index) internalID(ext string) uint {
+	ix.extMu.Lock()
+	defer ix.extMu.Unlock()
+	if id, ok := ix.ext.ids[ext]; ok {
+		return id
+	}
+	if ix.ext.ids == nil {
+		ix.ext.ids = map[string]uint{}
+		ix.ext.next = ExternalIDBase
+	}
+	id := ix.ext.next
+	ix.ext.next++
+	ix.ext.ids[ext] = id
+	return id
+}
+
+// IDFor returns the internal ID of the product with the given ExternalID,
+// for APIs that take a product ID such as Similar or Delete.
+func (ix *Index) IDFor(externalID string) (uint, bool) {
+	ix.extMu.Lock()
+	defer ix.extMu.Unlock()
+	id, ok := ix.ext.ids[externalID]
+	return id, ok
+}
+
+// restoreExternalIDs records the internal IDs of loaded docs, so products
+// keyed by ExternalID keep their IDs across a snapshot.
+func (ix *Index) restoreExternalIDs(docs []productDoc) {
+	ix.extMu.Lock()
+	defer ix.extMu.Unlock()
+	for _, d := range docs {
+		if d.P.ExternalID == "" || d.P.ID < ExternalIDBase {
+			continue
+		}
+		if ix.ext.ids == nil {
+			ix.ext.ids = map[string]uint{}
+			ix.ext.next = ExternalIDBase
+		}
+		ix.ext.ids[d.P.ExternalID] = d.P.ID
+		ix.ext.next = max(ix.ext.next, d.P.ID+1)
+	}
+}
@@ -0,0 +1,75 @@
+package searchindex
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Facet fields accepted by FacetValues.
+const (
+	FacetBrand    = "brand"
+	FacetCategory = "category"
+)
+
+// FacetValue is one distinct value of a facet field and how many indexed
+// products have it.
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// facetCache holds FacetValues results for one index generation.
+type facetCache struct {
+	mu     sync.Mutex
+	gen    uint64
+	values map[string][]FacetValue
+}
+
+// FacetValues returns the distinct values of field (FacetBrand or
+// FacetCategory) across the indexed products, most common first. Results
+// are computed once per generation, so repeated calls are cheap until the
+// next reindex. Blank brands are skipped. Callers must not modify the
+// returned slice.
+func (ix *Index) FacetValues(field string) ([]FacetValue, error) {
+	if field != FacetBrand && field != FacetCategory {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFacet, field)
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	c := &ix.facets
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil || c.gen != ix.generation {
+		c.gen, c.values = ix.generation, map[string][]FacetValue{}
+	}
+	if vs, ok := c.values[field]; ok {
+		return vs, nil
+	}
+
+	counts := map[string]int{}
+	for _, d := range ix.docs {
+		switch field {
+		case FacetBrand:
+			if d.P.Brand != "" {
+				counts[d.P.Brand]++
+			}
+		case FacetCategory:
+			counts[strconv.FormatUint(uint64(d.P.CategoryID), 10)]++
+		}
+	}
+	vs := make([]FacetValue, 0, len(counts))
+	for v, n := range counts {
+		vs = append(vs, FacetValue{Value: v, Count: n})
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		if vs[i].Count != vs[j].Count {
+			return vs[i].Count > vs[j].Count
+		}
+		return vs[i].Value < vs[j].Value
+	})
+	c.values[field] = vs
+	return vs, nil
+}
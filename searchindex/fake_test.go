@@ -0,0 +1,63 @@
+package searchindex
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"unicode"
+)
+
+// fakeDims is the length of fakeEmbedder vectors.
+const fakeDims = 32
+
+// fakeEmbedder embeds text as a bag of hashed words, so texts sharing
+// words are similar, without calling any API. Vectors are deliberately
+// not unit length. calls counts Embed calls.
+type fakeEmbedder struct {
+	calls atomic.Int64
+}
+
+func (e *fakeEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	e.calls.Add(1)
+	v := make([]float32, fakeDims)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		h := fnv.New32a()
+		h.Write([]byte(w))
+		v[h.Sum32()%fakeDims] += 2
+	}
+	v[0] += 0.1 // no zero vectors
+	return v, nil
+}
+
+// newTestIndex returns an Index over products with cfg applied, using
+// a fakeEmbedder.
+func newTestIndex(t *testing.T, cfg Config, products []Product) (*Index, *fakeEmbedder) {
+	t.Helper()
+	em := &fakeEmbedder{}
+	ix := NewWithEmbedder(em, "fake", cfg.SemanticWeight, cfg.FuzzyWeight)
+	if err := ix.SetConfig(cfg); err != nil {
+		t.Fatalf("SetConfig: %v", err)
+	}
+	if err := ix.Rebuild(context.Background(), products); err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	return ix, em
+}
+
+// testCatalog is a small phone and accessories catalog.
+func testCatalog() []Product {
+	return []Product{
+		{ID: 1, Title: "Galaxy S23", Brand: "Samsung", Description: "Android phone with triple camera", Price: 800},
+		{ID: 2, Title: "Galaxy S22", Brand: "Samsung", Description: "Last year's Android flagship", Price: 600},
+		{ID: 3, Title: "iPhone 15", Brand: "Apple", Description: "USB-C iPhone with dynamic island", Price: 900},
+		{ID: 4, Title: "iPhone 14", Brand: "Apple", Description: "A15 chip and dual camera", Price: 700},
+		{ID: 5, Title: "Lumia 950", Brand: "Nokia", Description: "PureView camera, AMOLED display", Price: 300},
+		{ID: 6, Title: "Pixel 8", Brand: "Google", Description: "Tensor chip and great camera", Price: 650},
+		{ID: 7, Title: "Running shoes", Brand: "Nike", Description: "Lightweight trainers for road running", Price: 120},
+		{ID: 8, Title: "Leather wallet", Brand: "Fossil", Description: "Slim bifold wallet in brown leather", Price: 45},
+	}
+}
@@ -0,0 +1,166 @@
+package searchindex
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Filter restricts a search to matching products. The zero value keeps
+// everything.
+type Filter struct {
+	// Statuses and CategoryIDs keep only products with one of the listed
+	// values; empty keeps any.
+	Statuses    []int  `json:"statuses,omitempty"`
+	CategoryIDs []uint `json:"categoryIds,omitempty"`
+	// MinPrice and MaxPrice bound Product.Price, inclusive; nil is
+	// unbounded.
+	MinPrice *float64 `json:"minPrice,omitempty"`
+	MaxPrice *float64 `json:"maxPrice,omitempty"`
+	// CreatedAfter and UpdatedAfter keep only products created or updated
+	// after the given time, e.g. "new this week"; the zero time keeps any.
+	// Products without the timestamp are dropped by a non-zero bound.
+	CreatedAfter time.Time `json:"createdAfter,omitzero"`
+	UpdatedAfter time.Time `json:"updatedAfter,omitzero"`
+	// MinScore drops results scoring below it, after boosts and
+	// calibration. 0 keeps every score.
+	MinScore float64 `json:"minScore,omitempty"`
+}
+
+// Reasons a product is left out of a search, reported by Index.Explain.
+const (
+	ExcludedStatus      = "status"
+	ExcludedCategory    = "category"
+	ExcludedPrice       = "price"
+	ExcludedRecency     = "recency"
+	ExcludedMinScore    = "minScore"
+	ExcludedMinSemantic = "minSemantic" // Config.MinSemantic
+	// ExcludedConfidence means the whole search came back empty; see
+	// Config.MinConfidence.
+	ExcludedConfidence = "minConfidence"
+)
+
+// excludes returns why f rejects p before scoring, or "" if it doesn't.
+func (f Filter) excludes(p Product) string {
+	switch {
+	case len(f.Statuses) > 0 && !slices.Contains(f.Statuses, p.Status):
+		return ExcludedStatus
+	case len(f.CategoryIDs) > 0 && !slices.Contains(f.CategoryIDs, p.CategoryID):
+		return ExcludedCategory
+	case f.MinPrice != nil && p.Price < *f.MinPrice,
+		f.MaxPrice != nil && p.Price > *f.MaxPrice:
+		return ExcludedPrice
+	case !f.CreatedAfter.IsZero() && !p.CreatedAt.After(f.CreatedAfter),
+		!f.UpdatedAfter.IsZero() && !p.UpdatedAt.After(f.UpdatedAfter):
+		return ExcludedRecency
+	}
+	return ""
+}
+
+// relax drops the filter named by an Excluded constant, reporting false if
+// f doesn't use it.
+func (f *Filter) relax(name string) bool {
+	switch name {
+	case ExcludedMinScore:
+		if f.MinScore == 0 {
+			return false
+		}
+		f.MinScore = 0
+	case ExcludedPrice:
+		if f.MinPrice == nil && f.MaxPrice == nil {
+			return false
+		}
+		f.MinPrice, f.MaxPrice = nil, nil
+	case ExcludedRecency:
+		if f.CreatedAfter.IsZero() && f.UpdatedAfter.IsZero() {
+			return false
+		}
+		f.CreatedAfter, f.UpdatedAfter = time.Time{}, time.Time{}
+	case ExcludedCategory:
+		if len(f.CategoryIDs) == 0 {
+			return false
+		}
+		f.CategoryIDs = nil
+	case ExcludedStatus:
+		if len(f.Statuses) == 0 {
+			return false
+		}
+		f.Statuses = nil
+	default:
+		return false
+	}
+	return true
+}
+
+// relaxable are the filters Config.Relaxation may name.
+var relaxable = []string{ExcludedMinScore, ExcludedPrice, ExcludedRecency, ExcludedCategory, ExcludedStatus}
+
+// Exclusion is Explain's account of one product for one search.
+type Exclusion struct {
+	ID      uint `json:"id"`
+	Indexed bool `json:"indexed"`
+	// ExcludedBy is the first filter that drops the product (one of the
+	// Excluded constants), or "" if it is returned.
+	ExcludedBy string `json:"excludedBy,omitempty"`
+	// Rank is the product's 1-based position among all results, so a
+	// product that is returned but below the requested topK shows up
+	// too. It is 0 when the product is excluded.
+	Rank int `json:"rank,omitempty"`
+	// Result is the product's scoring, when it was scored at all.
+	Result *SearchResult `json:"result,omitempty"`
+}
+
+// Explain reports what happens to product id when searching for query with
+// opts: whether it is indexed, which filter drops it, or where it ranks.
+// It runs the same search as SearchWithOptions, without a result limit.
+func (ix *Index) Explain(ctx context.Context, query string, id uint, opts SearchOptions) (Exclusion, error) {
+	ex := Exclusion{ID: id}
+	ix.mu.RLock()
+	i, ok := ix.byID[id]
+	var p Product
+	if ok {
+		p = ix.docs[i].P
+	}
+	ix.mu.RUnlock()
+	if !ok {
+		return ex, nil
+	}
+	ex.Indexed = true
+	if ex.ExcludedBy = opts.Filter.excludes(p); ex.ExcludedBy != "" {
+		return ex, nil
+	}
+
+	minScore := opts.Filter.MinScore
+	opts.Filter.MinScore = 0
+	opts.Explain = false
+	results, err := ix.SearchWithOptions(ctx, query, 0, opts)
+	if errors.Is(err, ErrNoConfidentMatch) {
+		ex.ExcludedBy = ExcludedConfidence
+		return ex, nil
+	}
+	if err != nil {
+		return ex, err
+	}
+	rank := 0
+	for _, r := range results {
+		if minScore > 0 && r.Score < minScore {
+			if r.Product.ID == id {
+				r.Explanation = explain(r)
+				ex.ExcludedBy, ex.Result = ExcludedMinScore, &r
+				return ex, nil
+			}
+			continue
+		}
+		rank++
+		if r.Product.ID == id {
+			r.Explanation = explain(r)
+			ex.Rank, ex.Result = rank, &r
+			return ex, nil
+		}
+	}
+	// Indexed and unfiltered but never scored: only the semantic floor
+	// drops products like that.
+	ex.ExcludedBy = ExcludedMinSemantic
+	return ex, nil
+}
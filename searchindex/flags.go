@@ -0,0 +1,67 @@
+package searchindex
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Per-request flags accepted in SearchOptions.Flags. Each overrides the
+// Config setting of the same name for one search, so ranking changes can be
+// compared side by side without a redeploy. Only scoring settings can be
+// flagged; anything that changes embeddings needs a reindex.
+const (
+	FlagBlend       = "blend"       // Config.Blend
+	FlagBrandBoost  = "brandBoost"  // Config.BrandBoost
+	FlagFuzzyMetric = "fuzzyMetric" // Config.FuzzyMetric
+	FlagLexical     = "lexical"     // Config.Lexical
+	// FlagTokenSetWeight sets Config.TokenSetWeight and switches
+	// Config.TokenSet to TokenSetBlend.
+	FlagTokenSetWeight = "tokenSetWeight"
+	// FlagWeightPrefix followed by a signal name, e.g. "weight.fuzzy",
+	// sets that entry of Config.Weights.
+	FlagWeightPrefix = "weight."
+)
+
+// withFlags returns c with flags applied. Unknown flags, and values that
+// don't parse or would make c invalid, are ignored.
+func (c Config) withFlags(flags map[string]string) Config {
+	for name, v := range flags {
+		next := c
+		switch {
+		case name == FlagBlend:
+			next.Blend = v
+		case name == FlagFuzzyMetric:
+			next.FuzzyMetric = v
+		case name == FlagLexical:
+			next.Lexical = v
+		case name == FlagTokenSetWeight:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			next.TokenSet, next.TokenSetWeight = TokenSetBlend, f
+		case name == FlagBrandBoost:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			next.BrandBoost = f
+		case strings.HasPrefix(name, FlagWeightPrefix):
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			next.Weights = make(map[string]float64, len(c.Weights)+1)
+			for k, w := range c.Weights {
+				next.Weights[k] = w
+			}
+			next.Weights[strings.TrimPrefix(name, FlagWeightPrefix)] = f
+		default:
+			continue
+		}
+		if next.Validate() == nil {
+			c = next
+		}
+	}
+	return c
+}
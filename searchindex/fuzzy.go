@@ -0,0 +1,334 @@
+package searchindex
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xrash/smetrics"
+)
+
+// Span is a [Start, End) range of character (rune) offsets into a field.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Field names reported in SearchResult.Field.
+const (
+	FieldTitle       = "title"
+	FieldBrand       = "brand"
+	FieldDescription = "description"
+	// FieldCombined is the product's embedded text as a whole; see
+	// Config.FuzzyCombined. It has no highlight.
+	FieldCombined = "combined"
+)
+
+// fuzzyFields is the order fields are compared in; on equal scores the
+// earlier field wins.
+var fuzzyFields = []string{FieldTitle, FieldBrand, FieldDescription}
+
+// highlightThreshold is the minimum token similarity that counts as a
+// lexical overlap worth highlighting.
+const highlightThreshold = 0.85
+
+func fieldText(p Product, field string) string {
+	switch field {
+	case FieldTitle:
+		return p.Title
+	case FieldBrand:
+		return p.Brand
+	case FieldDescription:
+		return p.Description
+	}
+	return ""
+}
+
+// fuzzyQuery is a query prepared once per search for the fuzzy scorer.
+type fuzzyQuery struct {
+	text string
+	// models are words containing digits ("s23", "14") that must appear
+	// verbatim in a field; only set with Config.StrictModelNumbers.
+	models []string
+	hints  []fieldHint
+	tok    Tokenizer
+	// words, prefixWeight and titlePrefixWeight feed the prefix
+	// components; see Config.PrefixWeight and Config.TitlePrefixWeight.
+	words             []string
+	prefixWeight      float64
+	titlePrefixWeight float64
+	// norms are the Config.FieldNormalization pipelines by field, and
+	// normed the query text and words run through each.
+	norms  map[string]normalizer
+	normed map[string]normedQuery
+	// sim is the Config.FuzzyMetric similarity.
+	sim func(a, b string) float64
+	// combined also scores the embedded text; see Config.FuzzyCombined.
+	combined bool
+}
+
+// normedQuery is the query text as one field's pipeline sees it.
+type normedQuery struct {
+	text  string
+	words []string
+}
+
+func (fq fuzzyQuery) empty() bool { return fq.text == "" && len(fq.hints) == 0 }
+
+// terms is every word the fuzzy scorer compares, for highlighting.
+func (fq fuzzyQuery) terms() string {
+	t := fq.text
+	for _, h := range fq.hints {
+		t += " " + h.value
+	}
+	return t
+}
+
+func prepareFuzzy(q string, cfg Config) fuzzyQuery {
+	tok := cfg.tokenizer()
+	sim, err := metricFunc(cfg.FuzzyMetric, tok)
+	if err != nil {
+		sim = jaroWinkler // unreachable for a validated Config
+	}
+	sim = withTokenSet(sim, tok, cfg)
+	fq := fuzzyQuery{
+		text:              dropShortTokens(tok, q, cfg.MinFuzzyTokenLen),
+		tok:               tok,
+		prefixWeight:      cfg.PrefixWeight,
+		titlePrefixWeight: cfg.TitlePrefixWeight,
+		norms:             cfg.normalizers(),
+		sim:               sim,
+		combined:          cfg.FuzzyCombined,
+	}
+	if fq.prefixWeight > 0 || fq.titlePrefixWeight > 0 {
+		fq.words = words(tok, fq.text)
+	}
+	if len(fq.norms) > 0 {
+		fq.normed = make(map[string]normedQuery, len(fq.norms))
+		for field, n := range fq.norms {
+			nq := normedQuery{text: n.apply(fq.text)}
+			if fq.words != nil {
+				nq.words = words(tok, nq.text)
+			}
+			fq.normed[field] = nq
+		}
+	}
+	if cfg.StrictModelNumbers {
+		for _, w := range words(tok, fq.text) {
+			if strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+				fq.models = append(fq.models, w)
+			}
+		}
+	}
+	return fq
+}
+
+// bestField returns the field that matches the query best and its
+// similarity. searchText is p's embedded text, compared as FieldCombined
+// after the other fields when fq.combined is set.
+//
+// Field hints are each scored against their own field and averaged with the
+// plain-text score.
+func (fq fuzzyQuery) bestField(p Product, searchText string) (string, float64) {
+	best, score := "", 0.0
+	if fq.text != "" {
+		for _, f := range fuzzyFields {
+			if s := fq.fieldScore(f, fieldText(p, f)); best == "" || s > score {
+				best, score = f, s
+			}
+		}
+		if fq.combined {
+			if s := fq.fieldScore(FieldCombined, searchText); s > score {
+				best, score = FieldCombined, s
+			}
+		}
+	}
+	if len(fq.hints) == 0 {
+		return best, score
+	}
+	total, n := score, 0
+	if fq.text != "" {
+		n = 1
+	}
+	for _, h := range fq.hints {
+		value, text := h.value, fieldText(p, h.field)
+		if n, ok := fq.norms[h.field]; ok {
+			value, text = n.apply(value), n.apply(text)
+		}
+		total += hintScore(fq.sim, fq.tok, value, text)
+		n++
+		if best == "" {
+			best = h.field
+		}
+	}
+	return best, total / float64(n)
+}
+
+// fieldScore is the fuzzy similarity of the query to field's text, both
+// run through the field's normalization pipeline, blended with the prefix
+// component and, for the title, the title-prefix component, then scaled
+// down by the share of model-number words text doesn't contain exactly, so
+// "s23" gets no credit from "Galaxy S22". FieldCombined goes through the
+// title's pipeline.
+func (fq fuzzyQuery) fieldScore(field, text string) float64 {
+	q, qWords := fq.text, fq.words
+	norm := field
+	if field == FieldCombined {
+		norm = FieldTitle
+	}
+	if n, ok := fq.norms[norm]; ok {
+		text = n.apply(text)
+		q, qWords = fq.normed[norm].text, fq.normed[norm].words
+	}
+	s := fq.sim(q, text)
+	if fq.prefixWeight > 0 && len(qWords) > 0 {
+		s = (1-fq.prefixWeight)*s + fq.prefixWeight*prefixScore(qWords, words(fq.tok, text))
+	}
+	if field == FieldTitle && fq.titlePrefixWeight > 0 && len(qWords) > 0 {
+		s = (1-fq.titlePrefixWeight)*s + fq.titlePrefixWeight*phrasePrefixScore(qWords, words(fq.tok, text))
+	}
+	if len(fq.models) == 0 || s == 0 {
+		return s
+	}
+	fieldWords := words(fq.tok, text)
+	found := 0
+	for _, m := range fq.models {
+		for _, w := range fieldWords {
+			if w == m {
+				found++
+				break
+			}
+		}
+	}
+	return s * float64(found) / float64(len(fq.models))
+}
+
+// highlight finds the longest run of adjacent words in text that each
+// closely match some query token. It returns nil when nothing overlaps.
+func highlight(tok Tokenizer, q, text string) *Span {
+	qToks := words(tok, q)
+	var (
+		best       *Span
+		bestWeight float64
+		run        *Span
+		runWeight  float64
+	)
+	for _, w := range tok.Tokenize(text) {
+		sim := 0.0
+		for _, t := range qToks {
+			if s := jaroWinkler(t, w.Text); s > sim {
+				sim = s
+			}
+		}
+		if sim < highlightThreshold {
+			run, runWeight = nil, 0
+			continue
+		}
+		if run == nil {
+			run = &Span{Start: w.Start}
+		}
+		run.End = w.End
+		runWeight += sim
+		if runWeight > bestWeight {
+			cp := *run
+			best, bestWeight = &cp, runWeight
+		}
+	}
+	return best
+}
+
+// prefixScore is the share of query words that are a prefix of some field
+// word.
+func prefixScore(qWords, fieldWords []string) float64 {
+	hits := 0
+	for _, q := range qWords {
+		for _, f := range fieldWords {
+			if strings.HasPrefix(f, q) {
+				hits++
+				break
+			}
+		}
+	}
+	return float64(hits) / float64(len(qWords))
+}
+
+// phrasePrefixScore is the longest run of query words that are, in order,
+// prefixes of consecutive field words, as a share of the query words: 1
+// for "galaxy s2" against "Samsung Galaxy S23", 0.5 for "s2 galaxy".
+func phrasePrefixScore(qWords, fieldWords []string) float64 {
+	best := 0
+	for i := range fieldWords {
+		for j := range qWords {
+			n := 0
+			for j+n < len(qWords) && i+n < len(fieldWords) && strings.HasPrefix(fieldWords[i+n], qWords[j+n]) {
+				n++
+			}
+			best = max(best, n)
+		}
+	}
+	return float64(best) / float64(len(qWords))
+}
+
+// containsPhrase reports whether phrase occurs as consecutive words in ws.
+func containsPhrase(ws, phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+	for i := 0; i+len(phrase) <= len(ws); i++ {
+		match := true
+		for j, p := range phrase {
+			if ws[i+j] != p {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// combinedMatch reports whether title contains a model-number query word
+// (one with a digit) and title or brand contains another query word.
+func combinedMatch(qWords, title, brand []string) bool {
+	model, other := false, false
+	for _, q := range qWords {
+		if !slices.Contains(title, q) {
+			if !slices.Contains(brand, q) {
+				continue
+			}
+			other = true
+		} else if strings.IndexFunc(q, unicode.IsDigit) >= 0 {
+			model = true
+		} else {
+			other = true
+		}
+		if model && other {
+			return true
+		}
+	}
+	return false
+}
+
+// dropShortTokens drops tokens shorter than minLen characters from q. The
+// result is empty when every token is too short.
+func dropShortTokens(tok Tokenizer, q string, minLen int) string {
+	if minLen <= 1 {
+		return q
+	}
+	var kept []string
+	for _, t := range words(tok, q) {
+		if utf8.RuneCountInString(t) >= minLen {
+			kept = append(kept, t)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+func jaroWinkler(a, b string) float64 {
+	a = strings.ToLower(strings.TrimSpace(a))
+	b = strings.ToLower(strings.TrimSpace(b))
+	return smetrics.JaroWinkler(a, b, 0.7, 4)
+}
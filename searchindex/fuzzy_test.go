@@ -0,0 +1,124 @@
+package searchindex
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// fuzzyOf returns product id's fuzzy score for q, searching ix.
+func fuzzyOf(t *testing.T, ix *Index, q string, id uint) (float64, string) {
+	t.Helper()
+	res, err := ix.Search(context.Background(), q, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range res {
+		if r.Product.ID == id {
+			return r.Why[SignalFuzzy], r.Field
+		}
+	}
+	t.Fatalf("%q: product %d not returned", q, id)
+	return 0, ""
+}
+
+func TestFuzzyCombinedMatchesBrandPlusModel(t *testing.T) {
+	off := DefaultConfig(0.7, 0.3)
+	ixOff, _ := newTestIndex(t, off, testCatalog())
+	without, _ := fuzzyOf(t, ixOff, "samsung s23", 1)
+
+	on := off
+	on.FuzzyCombined = true
+	ixOn, _ := newTestIndex(t, on, testCatalog())
+	with, field := fuzzyOf(t, ixOn, "samsung s23", 1)
+
+	if with <= without {
+		t.Errorf("fuzzy %.3f with FuzzyCombined, want above %.3f without", with, without)
+	}
+	if field != FieldCombined {
+		t.Errorf("matched field %q, want %q", field, FieldCombined)
+	}
+}
+
+func TestPhrasePrefixScoreAsTyped(t *testing.T) {
+	title := []string{"samsung", "galaxy", "s23"}
+	for _, tc := range []struct {
+		q    string
+		want float64
+	}{
+		{"gal", 1},
+		{"galaxy", 1},
+		{"galaxy s", 1},
+		{"galaxy s2", 1},
+		{"galaxy s23", 1},
+		{"galaxy s24", 0.5},
+		{"s2 galaxy", 0.5},
+		{"samsung gal s", 1},
+		{"pix", 0},
+	} {
+		if got := phrasePrefixScore(strings.Fields(tc.q), title); got != tc.want {
+			t.Errorf("phrasePrefixScore(%q) = %v, want %v", tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestTitlePrefixRanksPartialQuery(t *testing.T) {
+	cfg := DefaultConfig(0, 1)
+	cfg.TitlePrefixWeight = 0.5
+	ix, _ := newTestIndex(t, cfg, testCatalog())
+	for _, q := range []string{"gal", "galaxy s", "galaxy s2"} {
+		res, err := ix.Search(context.Background(), q, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) == 0 || res[0].Product.Brand != "Samsung" {
+			t.Errorf("%q: top result %v, want a Samsung Galaxy", q, res)
+		}
+	}
+}
+
+func TestExactTitleScoresOne(t *testing.T) {
+	ix, _ := newTestIndex(t, DefaultConfig(0.7, 0.3), testCatalog())
+	for _, q := range []string{"Galaxy S23", "galaxy s23", "  GALAXY   s23 ", "iphone 15"} {
+		res, err := ix.Search(context.Background(), q, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) == 0 || !res[0].ExactMatch || res[0].Score != 1 {
+			t.Fatalf("%q: top result %+v, want an exact match scoring 1", q, res)
+		}
+		if len(res) > 1 && res[1].Score >= 1 {
+			t.Errorf("%q: runner-up %q scores %v, want below 1", q, res[1].Product.Title, res[1].Score)
+		}
+	}
+}
+
+func TestPrefixWeightRanksBrandPrefixFirst(t *testing.T) {
+	off := DefaultConfig(0, 1)
+	ixOff, _ := newTestIndex(t, off, testCatalog())
+	without, _ := fuzzyOf(t, ixOff, "sam", 1)
+
+	on := off
+	on.PrefixWeight = 0.5
+	ixOn, _ := newTestIndex(t, on, testCatalog())
+	with, field := fuzzyOf(t, ixOn, "sam", 1)
+	if with <= without {
+		t.Errorf("fuzzy %.3f with PrefixWeight, want above %.3f without", with, without)
+	}
+	if field != FieldBrand {
+		t.Errorf("matched field %q, want %q", field, FieldBrand)
+	}
+
+	res, err := ixOn.Search(context.Background(), "sam", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) < 2 {
+		t.Fatalf("got %d results, want both Samsungs", len(res))
+	}
+	for i, r := range res[:2] {
+		if r.Product.Brand != "Samsung" {
+			t.Errorf("result %d is %s %s, want a Samsung", i, r.Product.Brand, r.Product.Title)
+		}
+	}
+}
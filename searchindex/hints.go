@@ -0,0 +1,121 @@
+package searchindex
+
+import "strings"
+
+// Field hints let a query target one field per token:
+//
+//	brand:samsung galaxy
+//	title:"galaxy s23" waterproof
+//
+// A hinted value is fuzzy-matched only against the named field, while the
+// other tokens are matched as usual. The "field:" prefix is stripped before
+// embedding. Supported fields are title, brand and description (alias desc).
+// Tokens with any other prefix, such as "usb:c", are left as plain text.
+
+// fieldHint is one field:value token.
+type fieldHint struct {
+	field string
+	value string
+}
+
+// hintFields maps accepted hint prefixes to field names.
+var hintFields = map[string]string{
+	"title":       FieldTitle,
+	"brand":       FieldBrand,
+	"description": FieldDescription,
+	"desc":        FieldDescription,
+}
+
+// parsedQuery is a query split into hinted and plain parts.
+type parsedQuery struct {
+	text  string // whole query without hint prefixes; what gets embedded
+	rest  string // plain tokens only
+	hints []fieldHint
+}
+
+// parseHints extracts field:value tokens from q. Values may be quoted to
+// span several words.
+func parseHints(q string) parsedQuery {
+	var pq parsedQuery
+	var text, rest []string
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		tok, tail := nextToken(q)
+		q = tail
+		if h, ok := parseHint(tok); ok {
+			pq.hints = append(pq.hints, h)
+			text = append(text, h.value)
+			continue
+		}
+		text = append(text, tok)
+		rest = append(rest, tok)
+	}
+	pq.text = strings.Join(text, " ")
+	pq.rest = strings.Join(rest, " ")
+	return pq
+}
+
+// parseHint reads tok as a field:value hint, reporting false for plain
+// tokens.
+func parseHint(tok string) (fieldHint, bool) {
+	i := strings.IndexByte(tok, ':')
+	if i <= 0 {
+		return fieldHint{}, false
+	}
+	field, ok := hintFields[strings.ToLower(tok[:i])]
+	v := strings.Trim(tok[i+1:], `"`)
+	if !ok || v == "" {
+		return fieldHint{}, false
+	}
+	return fieldHint{field: field, value: v}, true
+}
+
+// SplitHints separates the field:value tokens of q, kept as written, from
+// its plain text, so the plain text can be rewritten or spell-corrected
+// without mangling the hints. JoinHints puts them back.
+func SplitHints(q string) (plain, hints string) {
+	var p, h []string
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		tok, tail := nextToken(q)
+		q = tail
+		if _, ok := parseHint(tok); ok {
+			h = append(h, tok)
+		} else {
+			p = append(p, tok)
+		}
+	}
+	return strings.Join(p, " "), strings.Join(h, " ")
+}
+
+// JoinHints appends hints, as returned by SplitHints, to plain.
+func JoinHints(plain, hints string) string {
+	return strings.TrimSpace(plain + " " + hints)
+}
+
+// nextToken splits off the first whitespace-separated token of s, keeping a
+// quoted section such as title:"galaxy s23" together.
+func nextToken(s string) (tok, tail string) {
+	inQuote := false
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
+
+// hintScore is how well value matches text: the better of the whole-field
+// similarity and the best same-length run of words, so title:galaxy fully
+// matches "Samsung Galaxy S23".
+func hintScore(sim func(a, b string) float64, tok Tokenizer, value, text string) float64 {
+	best := sim(value, text)
+	vw, tw := words(tok, value), words(tok, text)
+	for i := 0; len(vw) > 0 && i+len(vw) <= len(tw); i++ {
+		if s := sim(strings.Join(vw, " "), strings.Join(tw[i:i+len(vw)], " ")); s > best {
+			best = s
+		}
+	}
+	return best
+}
@@ -0,0 +1,26 @@
+package searchindex
+
+import "testing"
+
+func TestSplitHints(t *testing.T) {
+	for _, tc := range []struct {
+		q, plain, hints string
+	}{
+		{"galaxy phone", "galaxy phone", ""},
+		{"brand:samsung galaxy", "galaxy", "brand:samsung"},
+		{`title:"galaxy s23" waterproof desc:ip68`, "waterproof", `title:"galaxy s23" desc:ip68`},
+		{"usb:c cable", "usb:c cable", ""},
+		{"brand: phone", "brand: phone", ""},
+		{"Brand:Apple", "", "Brand:Apple"},
+	} {
+		plain, hints := SplitHints(tc.q)
+		if plain != tc.plain || hints != tc.hints {
+			t.Errorf("SplitHints(%q) = %q, %q; want %q, %q", tc.q, plain, hints, tc.plain, tc.hints)
+		}
+		// A rewrite of the plain text keeps the hints' meaning.
+		joined := JoinHints(plain, hints)
+		if got, want := parseHints(joined).hints, parseHints(tc.q).hints; len(got) != len(want) {
+			t.Errorf("JoinHints(%q, %q) = %q: %d hints, want %d", plain, hints, joined, len(got), len(want))
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package searchindex
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queryHistory counts recorded queries with exponential decay, so recent
+// popularity outweighs old. It holds at most Config.QueryHistorySize
+// queries; past that the least popular are forgotten.
+type queryHistory struct {
+	mu      sync.Mutex
+	entries map[string]*historyEntry // normalized query -> entry
+}
+
+type historyEntry struct {
+	query string
+	// weight is the decayed count as of at.
+	weight float64
+	count  int
+	at     time.Time
+}
+
+// decayed returns e's weight at now for the given half-life.
+func (e *historyEntry) decayed(now time.Time, halfLife time.Duration) float64 {
+	if halfLife <= 0 {
+		return e.weight
+	}
+	return e.weight * math.Exp2(-float64(now.Sub(e.at))/float64(halfLife))
+}
+
+func (h *queryHistory) record(q string, now time.Time, cfg Config) {
+	key := strings.ToLower(q)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.entries == nil {
+		h.entries = map[string]*historyEntry{}
+	}
+	halfLife := time.Duration(cfg.QueryHistoryHalfLife)
+	e, ok := h.entries[key]
+	if !ok {
+		e = &historyEntry{query: q}
+		h.entries[key] = e
+	}
+	e.weight = e.decayed(now, halfLife) + 1
+	e.count++
+	e.at = now
+	if len(h.entries) > cfg.QueryHistorySize {
+		h.evict(now, halfLife, max(cfg.QueryHistorySize*9/10, 1))
+	}
+}
+
+// evict drops the least popular queries until keep remain. Evicting a
+// tenth at a time keeps the sort off the per-query path.
+func (h *queryHistory) evict(now time.Time, halfLife time.Duration, keep int) {
+	type kw struct {
+		key    string
+		weight float64
+	}
+	all := make([]kw, 0, len(h.entries))
+	for k, e := range h.entries {
+		all = append(all, kw{k, e.decayed(now, halfLife)})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].weight > all[j].weight })
+	for _, x := range all[keep:] {
+		delete(h.entries, x.key)
+	}
+}
+
+// RecordQuery adds a successful search to the query history behind
+// SuggestQueries. It does nothing unless Config.QueryHistorySize is set.
+func (ix *Index) RecordQuery(q string) {
+	cfg := ix.Config()
+	q = strings.Join(strings.Fields(q), " ")
+	if cfg.QueryHistorySize <= 0 || q == "" {
+		return
+	}
+	ix.history.record(q, time.Now(), cfg)
+}
+
+// SuggestQueries returns up to limit past queries for type-ahead, matching
+// prefix like Suggest does titles, most popular first. Popularity is the
+// query's count decayed by Config.QueryHistoryHalfLife, so recent searches
+// count for more. Queries recorded fewer than Config.QueryHistoryMinCount
+// times are never suggested.
+func (ix *Index) SuggestQueries(prefix string, limit int) []string {
+	cfg := ix.Config()
+	tok := cfg.tokenizer()
+	pw := words(tok, prefix)
+	if len(pw) == 0 || limit <= 0 {
+		return []string{}
+	}
+	now := time.Now()
+	halfLife := time.Duration(cfg.QueryHistoryHalfLife)
+
+	type cand struct {
+		query  string
+		weight float64
+	}
+	var cands []cand
+	ix.history.mu.Lock()
+	for _, e := range ix.history.entries {
+		if e.count < cfg.QueryHistoryMinCount || prefixScore(pw, words(tok, e.query)) < 1 {
+			continue
+		}
+		cands = append(cands, cand{e.query, e.decayed(now, halfLife)})
+	}
+	ix.history.mu.Unlock()
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].weight != cands[j].weight {
+			return cands[i].weight > cands[j].weight
+		}
+		return cands[i].query < cands[j].query
+	})
+	out := make([]string, 0, min(limit, len(cands)))
+	for _, c := range cands[:min(limit, len(cands))] {
+		out = append(out, c.query)
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package searchindex
+
+import (
+	"html"
+	"strings"
+)
+
+// stripHTML returns the visible text of an HTML fragment: tags become
+// spaces, script and style contents and comments are dropped, entities like
+// "&amp;" are decoded and runs of whitespace collapse to one space. A "<"
+// that doesn't start a tag, as in "size <5in", is kept as text.
+func stripHTML(s string) string {
+	if !strings.ContainsAny(s, "<&") {
+		return s
+	}
+	var b strings.Builder
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				break
+			}
+			s = s[end+3:]
+			continue
+		}
+		end := strings.IndexByte(s, '>')
+		if end < 0 || !startsTag(s[1:]) {
+			b.WriteByte('<')
+			s = s[1:]
+			continue
+		}
+		closing := s[1] == '/'
+		name := tagName(s[1:end])
+		s = s[end+1:]
+		if !closing && (name == "script" || name == "style") {
+			if close := strings.Index(strings.ToLower(s), "</"+name); close >= 0 {
+				s = s[close:]
+			} else {
+				s = ""
+			}
+		}
+		b.WriteByte(' ')
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(b.String())), " ")
+}
+
+// startsTag reports whether s, the text after a "<", begins a tag.
+func startsTag(s string) bool {
+	s = strings.TrimPrefix(s, "/")
+	return s != "" && (s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z' || s[0] == '!')
+}
+
+// tagName is the lowercased element name of a tag's contents, e.g. "br" for
+// "br/" or "p" for "/p" or `p class="x"`.
+func tagName(tag string) string {
+	tag = strings.TrimPrefix(tag, "/")
+	if i := strings.IndexAny(tag, " \t\n\r/"); i >= 0 {
+		tag = tag[:i]
+	}
+	return strings.ToLower(tag)
+}
@@ -0,0 +1,49 @@
+package searchindex
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStripHTML(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"plain text", "plain text"},
+		{"<p>Waterproof <b>running</b> shoes</p>", "Waterproof running shoes"},
+		{"line<br/>break<br>again", "line break again"},
+		{"<ul><li>6.1&quot; display</li><li>128&nbsp;GB</li></ul>", "6.1\" display 128 GB"},
+		{"Tom &amp; Jerry", "Tom & Jerry"},
+		{"size <5in", "size <5in"},
+		{"a < b and c > d", "a < b and c > d"},
+		{"before <!-- hidden -->after", "before after"},
+		{"open <!-- comment", "open"},
+		{`<div class="spec">USB-C</div>`, "USB-C"},
+		{"<script>var x = '<b>';</script>visible", "visible"},
+		{"<STYLE>p { color: red }</STYLE>Shown", "Shown"},
+		{"<script>never closed", ""},
+		{"  <p>\n  spaced \t out </p> ", "spaced out"},
+	} {
+		if got := stripHTML(tc.in); got != tc.want {
+			t.Errorf("stripHTML(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestStripHTMLDescriptions(t *testing.T) {
+	cfg := DefaultConfig(0.7, 0.3)
+	cfg.StripHTML = true
+	ix, _ := newTestIndex(t, cfg, []Product{
+		{ID: 1, Title: "Trail shoes", Brand: "Nike", Description: "<p>Grippy <b>trail</b> soles &amp; <em>waterproof</em> upper</p><script>track()</script>"},
+	})
+	res, err := ix.Search(context.Background(), "trail shoes", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("got %d results, want 1", len(res))
+	}
+	if got, want := res[0].Product.Description, "Grippy trail soles & waterproof upper"; got != want {
+		t.Errorf("description %q, want %q", got, want)
+	}
+}
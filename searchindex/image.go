@@ -0,0 +1,137 @@
+package searchindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	unified "google.golang.org/genai"
+)
+
+// maxImageBytes caps how much of an image is downloaded for embedding.
+const maxImageBytes = 20 << 20
+
+// ImageEmbedder embeds product images, and text into the same vector space
+// so queries can be compared with them, e.g. a multimodal embedding model.
+type ImageEmbedder interface {
+	Embedder
+	EmbedImage(ctx context.Context, url string) ([]float32, error)
+}
+
+// SetImageEmbedder enables image embeddings: products with an ImageURL get
+// an image vector at the next Rebuild, and Config.ImageWeight blends it into
+// the semantic score. Each search then also embeds the query with e.
+func (ix *Index) SetImageEmbedder(e ImageEmbedder) {
+	ix.mu.Lock()
+	ix.imgEm = e
+	ix.mu.Unlock()
+}
+
+// unifiedImageEmbedder uses a multimodal model through the
+// google.golang.org/genai SDK, downloading images itself.
+type unifiedImageEmbedder struct {
+	unifiedEmbedder
+	hc *http.Client
+}
+
+// NewUnifiedImageEmbedder returns an ImageEmbedder backed by a multimodal
+// embedding model. Images are fetched with hc, or http.DefaultClient when
+// it is nil.
+func NewUnifiedImageEmbedder(client *unified.Client, modelName string, hc *http.Client) ImageEmbedder {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return unifiedImageEmbedder{unifiedEmbedder: unifiedEmbedder{client: client, modelName: modelName}, hc: hc}
+}
+
+func (e unifiedImageEmbedder) EmbedImage(ctx context.Context, url string) ([]float32, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch image %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes))
+	if err != nil {
+		return nil, err
+	}
+	mime := resp.Header.Get("Content-Type")
+	if mime == "" {
+		mime = http.DetectContentType(data)
+	}
+	contents := []*unified.Content{unified.NewContentFromParts(
+		[]*unified.Part{unified.NewPartFromBytes(data, mime)}, unified.RoleUser)}
+	out, err := e.client.Models.EmbedContent(ctx, e.modelName, contents, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Embeddings) == 0 || out.Embeddings[0] == nil {
+		return nil, errors.New("empty embedding response")
+	}
+	return out.Embeddings[0].Values, nil
+}
+
+// embedImages fills in image vectors for jobs of kind vecImage, one call
+// each, bounded by cfg.EmbedTimeout like text embeddings. A product whose
+// image fails, e.g. a broken URL, is logged and keeps a nil image vector,
+// so it is still indexed and searched by its text; the next build retries
+// it. Only ctx ending stops the loop.
+func (ix *Index) embedImages(ctx context.Context, em ImageEmbedder, docs []productDoc, jobs []embedJob, cfg Config) error {
+	for _, j := range jobs {
+		if err := ctx.Err(); err != nil {
+			return &EmbeddingError{ProductID: docs[j.doc].P.ID, Err: fmt.Errorf("image: %w", err)}
+		}
+		jctx, cancel := ctx, context.CancelFunc(func() {})
+		if cfg.EmbedTimeout > 0 {
+			jctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.EmbedTimeout))
+		}
+		vec, err := em.EmbedImage(jctx, j.text)
+		cancel()
+		if err != nil {
+			log.Printf("searchindex: product %d: image %s not embedded: %v", docs[j.doc].P.ID, j.text, err)
+			continue
+		}
+		docs[j.doc].ImageEmbedding = vec
+	}
+	return nil
+}
+
+// embedImageQuery embeds query text with the image embedder, for comparing
+// with image vectors. It returns nil when no image embedder is set.
+func (ix *Index) embedImageQuery(ctx context.Context, text string, cfg Config) ([]float32, error) {
+	ix.mu.RLock()
+	em := ix.imgEm
+	ix.mu.RUnlock()
+	if em == nil {
+		return nil, nil
+	}
+	key := "image\x00" + text
+	if cfg.QueryCacheBytes > 0 {
+		if vec, ok := ix.qcache.get(key); ok {
+			return vec, nil
+		}
+	}
+	if cfg.EmbedTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.EmbedTimeout))
+		defer cancel()
+	}
+	vec, err := em.Embed(ctx, text)
+	if err != nil {
+		return nil, &EmbeddingError{Err: fmt.Errorf("image space: %w", err)}
+	}
+	if cfg.QueryCacheBytes > 0 {
+		ix.qcache.put(key, vec, cfg.QueryCacheBytes)
+	}
+	return vec, nil
+}
@@ -2,18 +2,29 @@ package searchindex
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"log"
 	"math"
-	"sort"
+	"math/rand/v2"
+	"slices"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	genai "github.com/google/generative-ai-go/genai"
-	"github.com/xrash/smetrics"
 )
 
 type Product struct {
+	// ID identifies the product. Catalogs keyed by strings (UUIDs, SKUs)
+	// leave it 0 and set ExternalID instead; the index then assigns an ID
+	// of at least ExternalIDBase, stable for the life of the Index, and
+	// results carry both.
 	ID          uint
+	ExternalID  string
 	SellerID    uint
 	CategoryID  uint
 	Title       string
@@ -21,126 +32,735 @@ type Product struct {
 	Brand       string
 	Status      int
 	Score       int
+	Variants    []Variant
+	// ImageURL is embedded when an ImageEmbedder is set; see
+	// Config.ImageWeight.
+	ImageURL string
+	Price    float64
+	// CreatedAt and UpdatedAt come from the source; Sync uses UpdatedAt as
+	// its watermark, and Filter can restrict searches by either.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Variant is one purchasable version of a product. Its attribute values are
+// indexed with the parent product, so "iphone 14 pro 256gb black" matches
+// the iPhone and reports the matching variant in SearchResult.Variant.
+type Variant struct {
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 type productDoc struct {
 	P          Product
 	Embedding  []float32
 	SearchText string
+	// Hash identifies the embedded text so unchanged products can reuse
+	// their embedding on the next Rebuild.
+	Hash [sha256.Size]byte
+	// terms and termCount are the word counts BM25 uses; see
+	// buildTermStats.
+	terms     map[string]int
+	termCount int
+	// Per-field vectors, only set when Config.FieldEmbeddings is on.
+	TitleEmbedding       []float32
+	DescriptionEmbedding []float32
+	// ImageEmbedding is set when image embeddings are enabled and the
+	// product has an ImageURL.
+	ImageEmbedding []float32
 }
 
 type SearchResult struct {
 	Product Product `json:"product"`
 	Score   float64 `json:"score"`
-	Why     struct {
-		Semantic float64 `json:"semantic"`
-		Fuzzy    float64 `json:"fuzzy"`
-	} `json:"why"`
+	// Why holds each signal's score before weighting, keyed by signal
+	// name (SignalSemantic, SignalFuzzy, and SignalLexical when
+	// Config.Lexical is set).
+	Why map[string]float64 `json:"why"`
+	// Field is the product field the fuzzy scorer matched best.
+	Field string `json:"field,omitempty"`
+	// Boosts lists the score adjustments applied on top of the blend.
+	Boosts map[string]float64 `json:"boosts,omitempty"`
+	// Highlight is the span of Field that overlaps the query lexically. It
+	// is nil when the match is purely semantic.
+	Highlight *Span `json:"highlight,omitempty"`
+	// Variant is the product variant whose attributes the query mentions
+	// most, e.g. the black 256GB SKU for "iphone 14 pro 256gb black". It is
+	// nil when the query names no variant attribute; results are always
+	// rolled up to the parent product.
+	Variant *Variant `json:"variant,omitempty"`
+	// MatchType says which signal dominated: MatchSemantic, MatchLexical
+	// (usually a typo or partial-word match) or MatchHybrid when the fuzzy
+	// and semantic signals are within Config.MatchTypeMargin of each other.
+	MatchType string `json:"matchType,omitempty"`
+	// ExactMatch is set when the query equals the product's title or
+	// brand; see Config.ExactMatchScore.
+	ExactMatch bool `json:"exactMatch,omitempty"`
+	// Relaxed lists the filters dropped to reach Config.MinResults, in the
+	// order they were dropped; empty when the search wasn't relaxed.
+	Relaxed []string `json:"relaxed,omitempty"`
+	// Partial is set on every result of a search that ran short of time
+	// and ranked what it had; see Config.PartialMargin.
+	Partial bool `json:"partial,omitempty"`
+	// Explanation describes the score in plain English for support teams.
+	// It is only set with SearchOptions.Explain.
+	Explanation string `json:"explanation,omitempty"`
+
+	// sig holds the signal scores while results are ranked; Why is only
+	// built from it for the results a search returns.
+	sig signalScores
+}
+
+// partialCheckEvery is how many documents are scored between deadline
+// checks when Config.PartialMargin is set.
+const partialCheckEvery = 256
+
+// MatchType values.
+const (
+	MatchSemantic = "semantic"
+	MatchLexical  = "lexical"
+	MatchHybrid   = "hybrid"
+)
+
+// matchType classifies a result from its Why values.
+func matchType(sem, fuz, margin float64) string {
+	switch {
+	case fuz-sem > margin:
+		return MatchLexical
+	case sem-fuz > margin:
+		return MatchSemantic
+	}
+	return MatchHybrid
 }
 
 type Index struct {
-	em             *genai.EmbeddingModel
-	modelName      string
-	semanticWeight float64
-	fuzzyWeight    float64
+	em        Embedder
+	modelName string
+
+	mu         sync.RWMutex
+	cfg        Config
+	cfgHash    string // see ConfigHash
+	docs       []productDoc
+	byID       map[uint]int // product ID -> position in docs
+	vocab      map[string]fieldSet
+	df         map[string]int // word -> products containing it
+	lex        lexicalStats
+	generation uint64
+
+	imgEm        ImageEmbedder
+	qcache       vecCache // query embeddings; see Config.QueryCacheBytes
+	tokens       tokenCounter
+	post         []ResultPostProcessor
+	facets       facetCache
+	history      queryHistory     // see RecordQuery
+	rates        map[uint]float64 // see SetConversionRates
+	sellerBoosts map[uint]float64 // see SetSellerBoosts
+	proj         *projection      // see Config.PCADimensions
+	fieldSel     FieldSelector    // see SetFieldSelector
 
-	mu   sync.RWMutex
-	docs []productDoc
+	extMu sync.Mutex
+	ext   externalIDs
+
+	readThrough readThrough // see ReadThrough
+
+	sortMu     sync.RWMutex
+	sortFields map[string]SortField // see RegisterSortField
+
+	// patchMu serializes every write to the corpus. Upsert, Delete and
+	// SyncSince hold it from reading the corpus they build on until they
+	// commit; full builds and Load take it to swap the corpus in, so a
+	// patch never commits over a corpus replaced since it started.
+	patchMu  sync.Mutex
+	syncMu   sync.Mutex
+	lastSync time.Time // see Sync
+}
+
+// ResultPostProcessor re-ranks or rewrites search results for business rules
+// that boosts can't express, e.g. promoting sponsored sellers. It receives
+// every scored result of a search, sorted by score, before they are cut to
+// topK, and returns the list to truncate. Results are not re-sorted
+// afterwards, so a processor that changes scores should sort itself. It
+// runs on the search path and must not call back into the Index.
+type ResultPostProcessor func([]SearchResult) []SearchResult
+
+// SetPostProcessors replaces the post-processors applied by Search, which
+// run in order.
+func (ix *Index) SetPostProcessors(ps ...ResultPostProcessor) {
+	ix.mu.Lock()
+	ix.post = ps
+	ix.mu.Unlock()
 }
 
 func New(ctx context.Context, client *genai.Client, modelName string, semanticWeight, fuzzyWeight float64) *Index {
+	return NewWithEmbedder(NewLegacyEmbedder(client, modelName), modelName, semanticWeight, fuzzyWeight)
+}
+
+// NewWithEmbedder is like New but takes any Embedder, e.g. one backed by the
+// google.golang.org/genai SDK.
+func NewWithEmbedder(em Embedder, modelName string, semanticWeight, fuzzyWeight float64) *Index {
+	cfg := DefaultConfig(semanticWeight, fuzzyWeight)
 	return &Index{
-		em:             client.EmbeddingModel(modelName),
-		modelName:      modelName,
-		semanticWeight: semanticWeight,
-		fuzzyWeight:    fuzzyWeight,
+		em:        em,
+		modelName: modelName,
+		cfg:       cfg,
+		cfgHash:   cfg.hash(),
 	}
 }
 
+// Rebuild replaces the indexed corpus with products. Products whose ID and
+// search text are unchanged since the previous build reuse their embedding
+// instead of calling the embedding API again.
 func (ix *Index) Rebuild(ctx context.Context, products []Product) error {
-	var docs []productDoc
-	for _, p := range products {
-		joined := strings.TrimSpace(strings.Join([]string{p.Title, p.Brand, p.Description}, " "))
-		if joined == "" {
-			continue
+	b := ix.NewBuilder()
+	if err := b.Add(ctx, products); err != nil {
+		return err
+	}
+	b.Commit()
+	return nil
+}
+
+// embed calls the embedder for one text, bounded by cfg.EmbedTimeout.
+// productID is 0 for queries and only used in errors.
+func (ix *Index) embed(parent context.Context, productID uint, text string, cfg Config) ([]float32, error) {
+	ctx := parent
+	if cfg.EmbedTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.EmbedTimeout))
+		defer cancel()
+	}
+	vec, err := ix.em.Embed(ctx, text)
+	if err != nil {
+		if embedTimedOut(parent, ctx) {
+			err = fmt.Errorf("timed out after %s: %w", time.Duration(cfg.EmbedTimeout), err)
+		}
+		return nil, &EmbeddingError{ProductID: productID, Err: err}
+	}
+	if productID == 0 {
+		ix.tokens.addSearch(text)
+	} else {
+		ix.tokens.addIndex(text)
+	}
+	return vec, nil
+}
+
+// embedTimedOut reports whether ctx, derived from parent for
+// Config.EmbedTimeout, expired on its own rather than with parent, so
+// errors don't blame EmbedTimeout for the caller's deadline.
+func embedTimedOut(parent, ctx context.Context) bool {
+	return ctx != parent && errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil
+}
+
+// embedBatch is embed for several texts in one call. firstID is the first
+// product in the batch, used in errors.
+func (ix *Index) embedBatch(parent context.Context, be BatchEmbedder, firstID uint, texts []string, cfg Config) ([][]float32, error) {
+	ctx := parent
+	if cfg.EmbedTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.EmbedTimeout))
+		defer cancel()
+	}
+	vecs, err := be.EmbedBatch(ctx, texts)
+	if err == nil && len(vecs) != len(texts) {
+		err = fmt.Errorf("got %d embeddings for %d texts", len(vecs), len(texts))
+	}
+	if err != nil {
+		if embedTimedOut(parent, ctx) {
+			err = fmt.Errorf("batch of %d timed out after %s: %w", len(texts), time.Duration(cfg.EmbedTimeout), err)
 		}
-		resp, err := ix.em.EmbedContent(ctx, genai.Text(joined))
-		if err != nil {
-			return fmt.Errorf("embed product %d: %w", p.ID, err)
+		return nil, &EmbeddingError{ProductID: firstID, Err: err}
+	}
+	ix.tokens.addIndex(texts...)
+	return vecs, nil
+}
+
+// embeddedDescription returns the part of p's description that is embedded.
+// The product keeps its full description; only the embedded copy is cut.
+func embeddedDescription(p Product, cfg Config) string {
+	desc := p.Description
+	if cfg.MaxDescriptionLen > 0 {
+		var cut bool
+		if desc, cut = truncateWords(desc, cfg.MaxDescriptionLen); cut {
+			log.Printf("searchindex: product %d description truncated to %d chars for embedding", p.ID, cfg.MaxDescriptionLen)
 		}
-		docs = append(docs, productDoc{
-			P:          p,
-			Embedding:  resp.Embedding.Values,
-			SearchText: joined,
-		})
 	}
-	ix.mu.Lock()
-	ix.docs = docs
-	ix.mu.Unlock()
-	return nil
+	return desc
+}
+
+// truncateWords shortens s to at most limit characters, cutting at the last
+// word boundary when there is one. It reports whether s was shortened.
+func truncateWords(s string, limit int) (string, bool) {
+	if utf8.RuneCountInString(s) <= limit {
+		return s, false
+	}
+	cut := []rune(s)[:limit]
+	if i := strings.LastIndexFunc(string(cut), unicode.IsSpace); i > 0 {
+		return strings.TrimSpace(string(cut)[:i]), true
+	}
+	return string(cut), true
+}
+
+// Len returns the number of indexed products.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Generation returns a counter that increases every time the indexed
+// corpus, its conversion rates, its seller boosts or its Config change. Results
+// computed at the same generation are stable.
+func (ix *Index) Generation() uint64 {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.generation
+}
+
+// ModelInfo identifies the embedding model behind an Index's vectors.
+type ModelInfo struct {
+	Model string `json:"model"`
+	// Dimensions is the length of the stored vectors; 0 until something
+	// is indexed.
+	Dimensions int `json:"dimensions"`
+}
+
+// ModelInfo returns the embedding model name and vector length in use.
+func (ix *Index) ModelInfo() ModelInfo {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	mi := ModelInfo{Model: ix.modelName}
+	if len(ix.docs) > 0 {
+		mi.Dimensions = len(ix.docs[0].Embedding)
+	}
+	return mi
+}
+
+// Contains reports whether product id is indexed. It doesn't call the
+// embedding API.
+func (ix *Index) Contains(id uint) bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	_, ok := ix.byID[id]
+	return ok
+}
+
+// SearchText returns the text embedded for product id, and false when it
+// isn't indexed.
+func (ix *Index) SearchText(id uint) (string, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	i, ok := ix.byID[id]
+	if !ok {
+		return "", false
+	}
+	return ix.docs[i].SearchText, true
+}
+
+// SearchOptions carries optional per-request inputs to SearchWithOptions.
+// The zero value searches exactly like Search.
+type SearchOptions struct {
+	// Context is recent session text, such as prior queries or the name of
+	// a selected category, oldest first. It is embedded together and
+	// blended into the query embedding with Config.ContextWeight, so
+	// "blue" after "running shoes" leans towards blue running shoes.
+	Context []string
+	// Flags override scoring settings for this search only, for online
+	// experiments; see FlagBlend and friends. Unknown flags and invalid
+	// values are ignored.
+	Flags map[string]string
+	// Explain fills in SearchResult.Explanation for the returned results.
+	Explain bool
+	// Filter drops products before or, for MinScore, after scoring.
+	Filter Filter
+	// Seed makes the Config.ShuffleEpsilon shuffle reproducible: the same
+	// seed gives the same order for the same results. 0 picks a random
+	// seed per search.
+	Seed uint64
+
+	// Sort orders the topK most relevant results by a product field
+	// instead of by score, e.g. "price" or "rating_desc"; see SortBy. ""
+	// keeps relevance order.
+	Sort string
+
+	// queryVec replaces the query's own embedding; see SearchMulti.
+	queryVec []float32
 }
 
 func (ix *Index) Search(ctx context.Context, query string, topK int) ([]SearchResult, error) {
-	q := strings.TrimSpace(query)
+	return ix.SearchWithOptions(ctx, query, topK, SearchOptions{})
+}
+
+// SearchWithOptions is Search with per-request options.
+func (ix *Index) SearchWithOptions(ctx context.Context, query string, topK int, opts SearchOptions) ([]SearchResult, error) {
+	results, err := ix.search(ctx, query, topK, opts)
+	cfg := ix.Config()
+	if err != nil || cfg.MinResults <= 0 {
+		return results, err
+	}
+	want := cfg.MinResults
+	if topK > 0 {
+		want = min(want, topK)
+	}
+	var relaxed []string
+	for _, step := range cfg.Relaxation {
+		if len(results) >= want || len(results) > 0 && results[0].Partial {
+			break
+		}
+		if !opts.Filter.relax(step) {
+			continue
+		}
+		relaxed = append(relaxed, step)
+		if results, err = ix.search(ctx, query, topK, opts); err != nil {
+			return nil, err
+		}
+	}
+	for i := range results {
+		results[i].Relaxed = relaxed
+	}
+	return results, nil
+}
+
+func (ix *Index) search(ctx context.Context, query string, topK int, opts SearchOptions) ([]SearchResult, error) {
+	pq := parseHints(query)
+	q := pq.text
 	if q == "" {
-		return []SearchResult{}, nil
+		return nil, ErrEmptyQuery
+	}
+	if ix.Len() == 0 {
+		return nil, ErrIndexEmpty
 	}
 
-	qResp, err := ix.em.EmbedContent(ctx, genai.Text(q))
+	embedCfg := ix.Config()
+	if tooGeneric(q, embedCfg) {
+		return nil, ErrTooGeneric
+	}
+	if opts.Sort != "" {
+		if _, _, err := ix.sortField(opts.Sort); err != nil {
+			return nil, err
+		}
+	}
+	// With PartialMargin, embedding stops PartialMargin before the
+	// deadline and scoring halfway through the margin, leaving the rest
+	// to rank and respond.
+	var partial bool
+	embedCtx, scanStop := ctx, time.Time{}
+	if dl, ok := ctx.Deadline(); ok && embedCfg.PartialMargin > 0 {
+		margin := time.Duration(embedCfg.PartialMargin)
+		var cancel context.CancelFunc
+		embedCtx, cancel = context.WithDeadline(ctx, dl.Add(-margin))
+		defer cancel()
+		scanStop = dl.Add(-margin / 2)
+	}
+	// cutShort reports whether err is embedding running into the
+	// PartialMargin cutoff, which the search survives with fewer signals.
+	cutShort := func(err error) bool {
+		return err != nil && embedCtx != ctx && errors.Is(embedCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+	}
+
+	qVec, err := opts.queryVec, error(nil)
+	if qVec == nil {
+		qVec, err = ix.embedQuery(embedCtx, q, embedCfg)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("embed query: %w", err)
+		switch {
+		case cutShort(err):
+			partial = true
+		case !embedCfg.FuzzyOnlyFallback || !errors.Is(err, ErrEmbedding) || ctx.Err() != nil:
+			return nil, err
+		}
+		log.Printf("searchindex: %v; searching %q without semantic scores", err, q)
+	}
+	if sc := sessionText(opts.Context); qVec != nil && sc != "" && embedCfg.ContextWeight > 0 {
+		cVec, err := ix.embedQuery(embedCtx, sc, embedCfg)
+		switch {
+		case cutShort(err):
+			partial = true
+		case err != nil:
+			return nil, err
+		case len(cVec) != len(qVec):
+			return nil, fmt.Errorf("%w: context has %d dimensions, query has %d",
+				ErrDimensionMismatch, len(cVec), len(qVec))
+		default:
+			qVec = blend(qVec, cVec, embedCfg.ContextWeight)
+		}
+	}
+	var iVec []float32
+	if qVec != nil && embedCfg.ImageWeight > 0 {
+		if iVec, err = ix.embedImageQuery(embedCtx, q, embedCfg); cutShort(err) {
+			iVec, partial = nil, true
+		} else if err != nil {
+			return nil, err
+		}
 	}
-	qVec := qResp.Embedding.Values
 
 	ix.mu.RLock()
 	defer ix.mu.RUnlock()
+	// Stored vectors were normalized before projection (see Builder.Add),
+	// so the query must be too, or centering on the mean skews it.
+	qVec = ix.proj.apply(unitVector(qVec))
+	if qVec != nil && len(ix.docs) > 0 && len(qVec) != len(ix.docs[0].Embedding) {
+		return nil, fmt.Errorf("%w: query has %d dimensions, index has %d",
+			ErrDimensionMismatch, len(qVec), len(ix.docs[0].Embedding))
+	}
+
+	cfg := ix.cfg.forCorpus(len(ix.docs)).withFlags(opts.Flags)
+	rest := pq.rest
+	if cfg.MaxDocFreq > 0 {
+		rest = dropCommonTokens(cfg.tokenizer(), rest, ix.df, len(ix.docs), cfg.MaxDocFreq)
+	}
+	fq := prepareFuzzy(rest, cfg)
+	fq.hints = pq.hints
+	tok := fq.tok
+	qWords := words(tok, q)
+	route := ""
+	if cfg.QueryRouting {
+		route = ix.routeLocked(qWords)
+	}
+
+	// Stored vectors are unit length (see Builder.Add), so normalizing the
+	// query once makes a dot product equal to cosine similarity.
+	qVec = unitVector(qVec)
+	if iVec != nil {
+		iVec = unitVector(iVec)
+	}
 
 	results := make([]SearchResult, 0, len(ix.docs))
-	for _, d := range ix.docs {
-		sem := cosine(qVec, d.Embedding)
-		fuz := max3(
-			jaroWinkler(q, d.P.Title),
-			jaroWinkler(q, d.P.Brand),
-			jaroWinkler(q, d.P.Description),
-		)
-		score := ix.semanticWeight*sem + ix.fuzzyWeight*fuz
+	for i, d := range ix.docs {
+		if !scanStop.IsZero() && i%partialCheckEvery == 0 && time.Now().After(scanStop) {
+			partial = true
+			break
+		}
+		if opts.Filter.excludes(d.P) != "" {
+			continue
+		}
+		sem := dot(qVec, d.routedEmbedding(route))
+		if iVec != nil && d.ImageEmbedding != nil {
+			sem = (1-cfg.ImageWeight)*sem + cfg.ImageWeight*dot(iVec, d.ImageEmbedding)
+		}
+		var fuz float64
+		var field string
+		if !fq.empty() {
+			field, fuz = fq.bestField(d.P, d.SearchText)
+		}
 
 		var r SearchResult
 		r.Product = d.P
-		r.Score = score
-		r.Why.Semantic = sem
-		r.Why.Fuzzy = fuz
+		r.sig = signalScores{semantic: sem, fuzzy: fuz}
+		if cfg.Lexical == LexicalBM25 {
+			r.sig.lexical, r.sig.hasLexical = ix.bm25(qWords, d), true // normalized below
+		}
+		r.MatchType = matchType(sem, fuz, cfg.MatchTypeMargin)
+		if cfg.ExactMatchScore > 0 {
+			r.ExactMatch = slices.Equal(qWords, words(tok, d.P.Title)) || slices.Equal(qWords, words(tok, d.P.Brand))
+		}
+		if cfg.MinSemantic > 0 && qVec != nil && sem < cfg.MinSemantic && !r.ExactMatch {
+			continue
+		}
+		if fuz > 0 {
+			r.Field = field
+			r.Highlight = highlight(tok, fq.terms(), fieldText(d.P, field))
+		}
+		r.Variant = matchVariant(tok, qWords, d.P.Variants)
 		results = append(results, r)
 	}
 
-	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if cfg.Lexical == LexicalBM25 {
+		var top float64
+		for _, r := range results {
+			top = max(top, r.sig.lexical)
+		}
+		if top > 0 {
+			for i := range results {
+				results[i].sig.lexical /= top
+			}
+		}
+	}
+
+	// Blend the signals, then add boosts on top.
+	weights := cfg.weights()
+	if cfg.Blend == BlendRRF {
+		applyRRF(results, weights)
+	} else {
+		for i := range results {
+			results[i].Score = weightedSum(results[i].sig, weights)
+		}
+	}
+	var category uint
+	if cfg.CategoryBoost > 0 {
+		category, _ = inferCategory(results)
+	}
+	for i := range results {
+		r, p := &results[i], results[i].Product
+		if category != 0 && p.CategoryID == category {
+			r.addBoost("category", cfg.CategoryBoost)
+		}
+		if cfg.BrandBoost > 0 && containsPhrase(qWords, words(tok, p.Brand)) {
+			r.addBoost("brand", cfg.BrandBoost)
+		}
+		if cfg.CombinedBoost > 0 && combinedMatch(qWords, words(tok, p.Title), words(tok, p.Brand)) {
+			r.addBoost("combined", cfg.CombinedBoost)
+		}
+		if cfg.AvailabilityBoost > 0 && cfg.AvailabilityBoost != 1 && slices.Contains(cfg.AvailableStatuses, p.Status) {
+			// Scale by magnitude so a boost always raises the score, even
+			// when the blend is negative.
+			r.addBoost("availability", math.Abs(r.Score)*(cfg.AvailabilityBoost-1))
+		}
+		if rate := ix.rates[p.ID]; cfg.ConversionBoost > 0 && rate > 0 {
+			r.addBoost("conversion", cfg.ConversionBoost*rate)
+		}
+		if m, ok := ix.sellerBoosts[p.SellerID]; ok && m != 1 {
+			r.addBoost("seller", math.Abs(r.Score)*(m-1))
+		}
+	}
+
+	if cfg.Calibration == CalibrationLogistic {
+		for i := range results {
+			results[i].Score = 1 / (1 + math.Exp(-cfg.CalibrationSteepness*(results[i].Score-cfg.CalibrationMidpoint)))
+		}
+	}
+
+	for i := range results {
+		if results[i].ExactMatch {
+			results[i].Score = cfg.ExactMatchScore
+		}
+	}
+
+	if cfg.MinConfidence > 0 && len(results) > 0 &&
+		!slices.ContainsFunc(results, func(r SearchResult) bool { return r.Score >= cfg.MinConfidence }) {
+		return nil, ErrNoConfidentMatch
+	}
+
+	if opts.Filter.MinScore > 0 {
+		results = slices.DeleteFunc(results, func(r SearchResult) bool { return r.Score < opts.Filter.MinScore })
+	}
+
+	SortResults(results, cfg.Tiebreakers)
+	if cfg.ShuffleEpsilon > 0 {
+		ShuffleBands(results, cfg.ShuffleEpsilon, opts.Seed)
+	}
+	if len(ix.post) > 0 {
+		fillWhy(results) // post-processors see every result's Why
+	}
+	for _, p := range ix.post {
+		results = p(results)
+	}
+	if cfg.MaxPerSeller > 0 {
+		results = diversifySellers(results, cfg.MaxPerSeller)
+	}
 	if topK > 0 && topK < len(results) {
 		results = results[:topK]
 	}
+	fillWhy(results)
+	if opts.Sort != "" {
+		_ = ix.SortBy(results, opts.Sort) // checked above
+	}
+	if opts.Explain {
+		for i := range results {
+			results[i].Explanation = explain(results[i])
+		}
+	}
+	if partial {
+		for i := range results {
+			results[i].Partial = true
+		}
+	}
 	return results, nil
 }
 
-func cosine(a, b []float32) float64 {
-	if len(a) == 0 || len(b) == 0 || len(a) != len(b) {
+// ShuffleBands shuffles sorted results within bands of scores at most eps
+// apart, as Config.ShuffleEpsilon does; seed is as in SearchOptions.Seed.
+// Callers that merge and re-sort results from several searches call it
+// again afterwards.
+func ShuffleBands(results []SearchResult, eps float64, seed uint64) {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	rng := rand.New(rand.NewPCG(seed, seed))
+	for start := 0; start < len(results); {
+		end := start + 1
+		for end < len(results) && results[start].Score-results[end].Score <= eps {
+			end++
+		}
+		band := results[start:end]
+		rng.Shuffle(len(band), func(i, j int) { band[i], band[j] = band[j], band[i] })
+		start = end
+	}
+}
+
+// diversifySellers keeps results in order but moves each seller's results
+// beyond the first perSeller below all the others, preserving their order.
+func diversifySellers(results []SearchResult, perSeller int) []SearchResult {
+	seen := map[uint]int{}
+	out := make([]SearchResult, 0, len(results))
+	var overflow []SearchResult
+	for _, r := range results {
+		if seen[r.Product.SellerID] < perSeller {
+			seen[r.Product.SellerID]++
+			out = append(out, r)
+		} else {
+			overflow = append(overflow, r)
+		}
+	}
+	return append(out, overflow...)
+}
+
+// addBoost adds delta to the score and records it under name.
+func (r *SearchResult) addBoost(name string, delta float64) {
+	if r.Boosts == nil {
+		r.Boosts = map[string]float64{}
+	}
+	r.Boosts[name] += delta
+	r.Score += delta
+}
+
+// dot is the cosine similarity of two unit vectors. Vectors of different
+// lengths score 0.
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
 		return 0
 	}
-	var dot, na, nb float64
+	var s float64
 	for i := range a {
-		dot += float64(a[i] * b[i])
-		na += float64(a[i] * a[i])
-		nb += float64(b[i] * b[i])
+		s += float64(a[i] * b[i])
 	}
-	den := math.Sqrt(na) * math.Sqrt(nb)
-	if den == 0 {
-		return 0
+	return s
+}
+
+// sessionText joins the non-blank context entries into one text to embed.
+func sessionText(entries []string) string {
+	var parts []string
+	for _, e := range entries {
+		if e = strings.TrimSpace(e); e != "" {
+			parts = append(parts, e)
+		}
 	}
-	return dot / den
+	return strings.Join(parts, "; ")
 }
 
-func jaroWinkler(a, b string) float64 {
-	a = strings.ToLower(strings.TrimSpace(a))
-	b = strings.ToLower(strings.TrimSpace(b))
-	return smetrics.JaroWinkler(a, b, 0.7, 4)
+// blend mixes the unit-length directions of q and c as (1-w)*q + w*c, so
+// the result leans towards c without either vector's magnitude mattering.
+func blend(q, c []float32, w float64) []float32 {
+	q, c = unitVector(q), unitVector(c)
+	out := make([]float32, len(q))
+	for i := range q {
+		out[i] = float32((1-w)*float64(q[i]) + w*float64(c[i]))
+	}
+	return out
 }
 
-func max3(a, b, c float64) float64 { return math.Max(a, math.Max(b, c)) }
+// unitVector returns v scaled to unit length. v itself is returned when it
+// is already (close to) unit length, and is never modified.
+func unitVector(v []float32) []float32 {
+	var n float64
+	for _, x := range v {
+		n += float64(x * x)
+	}
+	n = math.Sqrt(n)
+	if n == 0 || math.Abs(n-1) < 1e-6 {
+		return v
+	}
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(float64(x) / n)
+	}
+	return out
+}
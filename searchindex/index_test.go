@@ -0,0 +1,94 @@
+package searchindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWhyFilledForReturnedResults(t *testing.T) {
+	ctx := context.Background()
+	cfg := DefaultConfig(0.7, 0.3)
+	cfg.Lexical = LexicalBM25
+	cfg.LexicalWeight = 0.2
+	ix, _ := newTestIndex(t, cfg, testCatalog())
+
+	var seen int
+	ix.SetPostProcessors(func(rs []SearchResult) []SearchResult {
+		for _, r := range rs {
+			if r.Why == nil {
+				t.Errorf("post-processor: product %d has no Why", r.Product.ID)
+			}
+		}
+		seen = len(rs)
+		return rs
+	})
+	res, err := ix.Search(ctx, "galaxy camera", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != len(testCatalog()) {
+		t.Errorf("post-processor saw %d results, want all %d", seen, len(testCatalog()))
+	}
+	for _, r := range res {
+		for _, name := range []string{SignalSemantic, SignalFuzzy, SignalLexical} {
+			if _, ok := r.Why[name]; !ok {
+				t.Errorf("product %d: Why has no %s", r.Product.ID, name)
+			}
+		}
+		if got, want := r.Score, weightedSum(r.sig, cfg.weights()); r.Boosts == nil && !r.ExactMatch && got != want {
+			t.Errorf("product %d: score %v, want the blend %v of Why", r.Product.ID, got, want)
+		}
+	}
+}
+
+func TestWhyNotAllocatedPerScoredDoc(t *testing.T) {
+	ctx := context.Background()
+	const n = 200
+	products := make([]Product, n)
+	for i := range products {
+		products[i] = Product{ID: uint(i + 1), Title: fmt.Sprintf("Phone %d", i), Brand: "Acme"}
+	}
+	ix, _ := newTestIndex(t, DefaultConfig(0.7, 0.3), products)
+	allocs := func(topK int) float64 {
+		return testing.AllocsPerRun(10, func() {
+			if _, err := ix.Search(ctx, "acme phone", topK); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	// Returning every result builds every Why; returning one builds one.
+	if all, one := allocs(0), allocs(1); all-one < n/2 {
+		t.Errorf("search allocates %v times for all results and %v for one, want Why built only for returned results", all, one)
+	}
+}
+
+// blockingEmbedder never answers; Embed returns when ctx is done.
+type blockingEmbedder struct{}
+
+func (blockingEmbedder) Embed(ctx context.Context, _ string) ([]float32, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestEmbedTimeoutBlamesTheRightDeadline(t *testing.T) {
+	ix := NewWithEmbedder(blockingEmbedder{}, "blocking", 0.7, 0.3)
+	cfg := DefaultConfig(0.7, 0.3)
+
+	cfg.EmbedTimeout = Duration(10 * time.Millisecond)
+	_, err := ix.embed(context.Background(), 0, "phone", cfg)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Errorf("EmbedTimeout expiring: %v, want it named", err)
+	}
+
+	cfg.EmbedTimeout = Duration(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ix.embed(ctx, 0, "phone", cfg)
+	if !errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "timed out after") {
+		t.Errorf("caller's deadline expiring: %v, want EmbedTimeout left out", err)
+	}
+}
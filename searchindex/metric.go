@@ -0,0 +1,229 @@
+package searchindex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Fuzzy metrics accepted by Config.FuzzyMetric. Each returns a similarity
+// in [0, 1] between the query (or a hint value) and a field.
+const (
+	// MetricJaroWinkler rewards shared prefixes; good for typos (default).
+	MetricJaroWinkler = "jaro-winkler"
+	// MetricLevenshtein is 1 - edit distance / length of the longer text.
+	MetricLevenshtein = "levenshtein"
+	// MetricNGram is the Dice coefficient of character trigrams, which is
+	// robust to word order and transpositions.
+	MetricNGram = "ngram"
+	// MetricTokenSet is the share of query words found in the field.
+	MetricTokenSet = "tokenset"
+)
+
+// Ways Config.TokenSet combines the FuzzyMetric score with the token-set
+// score.
+const (
+	// TokenSetMax takes the higher of the two, so a query matches as well
+	// as its better reading.
+	TokenSetMax = "max"
+	// TokenSetBlend mixes them by Config.TokenSetWeight, so word order
+	// counts for something without deciding the score.
+	TokenSetBlend = "blend"
+)
+
+// Blend modes accepted by Config.Blend.
+const (
+	// BlendWeighted sums each signal times its weight.
+	BlendWeighted = "weighted-sum"
+	// BlendRRF is reciprocal rank fusion: each signal contributes
+	// weight/(rrfK+rank), so only the order within each signal matters.
+	BlendRRF = "rrf"
+)
+
+// rrfK damps the influence of top ranks in reciprocal rank fusion; 60 is
+// the value from the original RRF paper.
+const rrfK = 60
+
+// metricFunc returns the similarity function named by metric.
+func metricFunc(metric string, tok Tokenizer) (func(a, b string) float64, error) {
+	switch metric {
+	case "", MetricJaroWinkler:
+		return jaroWinkler, nil
+	case MetricLevenshtein:
+		return levenshteinSim, nil
+	case MetricNGram:
+		return trigramSim, nil
+	case MetricTokenSet:
+		return func(a, b string) float64 { return tokenSetSim(tok, a, b) }, nil
+	}
+	return nil, fmt.Errorf("unknown fuzzy metric %q (want %s, %s, %s or %s)",
+		metric, MetricJaroWinkler, MetricLevenshtein, MetricNGram, MetricTokenSet)
+}
+
+func levenshteinSim(a, b string) float64 {
+	ra := []rune(strings.ToLower(strings.TrimSpace(a)))
+	rb := []rune(strings.ToLower(strings.TrimSpace(b)))
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 0
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+func trigramSim(a, b string) float64 {
+	ga, gb := trigrams(a), trigrams(b)
+	if len(ga) == 0 || len(gb) == 0 {
+		return 0
+	}
+	shared := 0
+	for g, n := range ga {
+		shared += min(n, gb[g])
+	}
+	total := 0
+	for _, n := range ga {
+		total += n
+	}
+	for _, n := range gb {
+		total += n
+	}
+	return 2 * float64(shared) / float64(total)
+}
+
+// trigrams counts the character trigrams of s, padded so short words
+// still produce some.
+func trigrams(s string) map[string]int {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if utf8.RuneCountInString(s) == 0 {
+		return nil
+	}
+	r := []rune("  " + s + " ")
+	out := map[string]int{}
+	for i := 0; i+3 <= len(r); i++ {
+		out[string(r[i:i+3])]++
+	}
+	return out
+}
+
+func tokenSetSim(tok Tokenizer, a, b string) float64 {
+	qa := words(tok, a)
+	if len(qa) == 0 {
+		return 0
+	}
+	in := map[string]bool{}
+	for _, w := range words(tok, b) {
+		in[w] = true
+	}
+	hits := 0
+	for _, w := range qa {
+		if in[w] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(qa))
+}
+
+// withTokenSet returns sim combined with tokenSetSim as cfg.TokenSet asks,
+// or sim itself when it's off or FuzzyMetric already is the token-set
+// metric.
+func withTokenSet(sim func(a, b string) float64, tok Tokenizer, cfg Config) func(a, b string) float64 {
+	if cfg.TokenSet == "" || cfg.FuzzyMetric == MetricTokenSet {
+		return sim
+	}
+	w := cfg.TokenSetWeight
+	return func(a, b string) float64 {
+		whole, set := sim(a, b), tokenSetSim(tok, a, b)
+		if cfg.TokenSet == TokenSetMax {
+			return max(whole, set)
+		}
+		return (1-w)*whole + w*set
+	}
+}
+
+// signalScores is a result's score from each signal. It is a struct
+// rather than a map so scoring every doc doesn't allocate; fillWhy turns
+// it into SearchResult.Why.
+type signalScores struct {
+	semantic, fuzzy, lexical float64
+	hasLexical               bool // set when Config.Lexical is
+}
+
+// get returns the score of the named signal, 0 for unknown names.
+func (s signalScores) get(name string) float64 {
+	switch name {
+	case SignalSemantic:
+		return s.semantic
+	case SignalFuzzy:
+		return s.fuzzy
+	case SignalLexical:
+		return s.lexical
+	}
+	return 0
+}
+
+// why returns s as a SearchResult.Why map.
+func (s signalScores) why() map[string]float64 {
+	m := map[string]float64{SignalSemantic: s.semantic, SignalFuzzy: s.fuzzy}
+	if s.hasLexical {
+		m[SignalLexical] = s.lexical
+	}
+	return m
+}
+
+// fillWhy sets Why from the signal scores on results that don't have it.
+func fillWhy(results []SearchResult) {
+	for i := range results {
+		if results[i].Why == nil {
+			results[i].Why = results[i].sig.why()
+		}
+	}
+}
+
+// weightedSum is the BlendWeighted score of sig. Signals are summed in a
+// fixed order so a product scores the same on every search.
+func weightedSum(sig signalScores, weights map[string]float64) float64 {
+	var s float64
+	for _, name := range signals {
+		s += weights[name] * sig.get(name)
+	}
+	return s
+}
+
+// applyRRF scores each result by reciprocal rank fusion: for every weighted
+// signal, weight/(rrfK+rank) where rank is the result's position when
+// sorted by that signal.
+func applyRRF(results []SearchResult, weights map[string]float64) {
+	for i := range results {
+		results[i].Score = 0
+	}
+	idx := make([]int, len(results))
+	for _, name := range signals { // fixed order, as in weightedSum
+		w := weights[name]
+		if w == 0 {
+			continue
+		}
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.SliceStable(idx, func(a, b int) bool { return results[idx[a]].sig.get(name) > results[idx[b]].sig.get(name) })
+		for rank, i := range idx {
+			results[i].Score += w / float64(rrfK+rank+1)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package searchindex
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestTokenSetDefaultsToMax(t *testing.T) {
+	if got := DefaultConfig(0.7, 0.3).TokenSet; got != TokenSetMax {
+		t.Fatalf("default TokenSet = %q, want %q", got, TokenSetMax)
+	}
+	cfg := DefaultConfig(0.7, 0.3)
+	cfg.TokenSet = "maximum"
+	if cfg.Validate() == nil {
+		t.Error("unknown TokenSet passed validation")
+	}
+}
+
+func TestTokenSetReorderedQueries(t *testing.T) {
+	galaxy := Product{Title: "Galaxy S23 Ultra", Brand: "Samsung"}
+	for _, q := range []string{"s23 galaxy", "ultra galaxy s23", "s23 ultra galaxy"} {
+		off := DefaultConfig(0.7, 0.3)
+		off.TokenSet = ""
+		_, without := prepareFuzzy(q, off).bestField(galaxy, "")
+
+		for _, mode := range []string{TokenSetMax, TokenSetBlend} {
+			on := DefaultConfig(0.7, 0.3)
+			on.TokenSet = mode
+			_, with := prepareFuzzy(q, on).bestField(galaxy, "")
+			if with <= without {
+				t.Errorf("%q, %s: fuzzy %.3f, no better than %.3f without token set", q, mode, with, without)
+			}
+		}
+		def := DefaultConfig(0.7, 0.3)
+		if _, s := prepareFuzzy(q, def).bestField(galaxy, ""); s != 1 {
+			t.Errorf("%q: TokenSetMax fuzzy %.3f, want 1 with every word in the title", q, s)
+		}
+	}
+}
+
+func TestTokenSetRanksReorderedModelFirst(t *testing.T) {
+	cfg := DefaultConfig(0, 1)
+	ix, _ := newTestIndex(t, cfg, testCatalog())
+	res, err := ix.Search(context.Background(), "s23 galaxy", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Product.ID != 1 {
+		t.Errorf("top result %q, want Galaxy S23", res[0].Product.Title)
+	}
+}
+
+func TestRRFBlendIsDeterministic(t *testing.T) {
+	weights := map[string]float64{SignalSemantic: 0.7, SignalFuzzy: 0.1, SignalLexical: 0.2}
+	newResults := func() []SearchResult {
+		rs := make([]SearchResult, 50)
+		for i := range rs {
+			rs[i].sig = signalScores{
+				semantic:   float64((i*37)%50) / 50,
+				fuzzy:      float64((i*11)%50) / 50,
+				lexical:    float64((i*23)%50) / 50,
+				hasLexical: true,
+			}
+		}
+		return rs
+	}
+	want := newResults()
+	applyRRF(want, weights)
+	for run := range 200 {
+		got := newResults()
+		applyRRF(got, weights)
+		for i := range got {
+			if math.Float64bits(got[i].Score) != math.Float64bits(want[i].Score) {
+				t.Fatalf("run %d: result %d scored %v, first run %v", run, i, got[i].Score, want[i].Score)
+			}
+		}
+	}
+
+	cfg := DefaultConfig(0.7, 0.1)
+	cfg.Blend = BlendRRF
+	cfg.Lexical = LexicalBM25
+	cfg.LexicalWeight = 0.2
+	ix, _ := newTestIndex(t, cfg, testCatalog())
+	first := map[uint]uint64{}
+	for run := range 200 {
+		res, err := ix.Search(context.Background(), "android camera phone", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range res {
+			bits := math.Float64bits(r.Score)
+			if run == 0 {
+				first[r.Product.ID] = bits
+			} else if bits != first[r.Product.ID] {
+				t.Fatalf("run %d: product %d scored %v, first run %v", run, r.Product.ID, r.Score, math.Float64frombits(first[r.Product.ID]))
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package searchindex
+
+import (
+	"context"
+	"testing"
+)
+
+// adjacentModels pairs each query with the product it names and the
+// neighbouring model it must not be confused with.
+var adjacentModels = []struct {
+	q           string
+	want, other uint
+}{
+	{"galaxy s23", 1, 2},
+	{"galaxy s22", 2, 1},
+	{"iphone 15", 3, 4},
+	{"iphone 14", 4, 3},
+}
+
+func TestStrictModelNumbersRejectsAdjacentModels(t *testing.T) {
+	loose, _ := newTestIndex(t, DefaultConfig(0.7, 0.3), testCatalog())
+	cfg := DefaultConfig(0.7, 0.3)
+	cfg.StrictModelNumbers = true
+	strict, _ := newTestIndex(t, cfg, testCatalog())
+
+	for _, tc := range adjacentModels {
+		if s, _ := fuzzyOf(t, loose, tc.q, tc.other); s < 0.5 {
+			t.Errorf("%q: loose fuzzy for product %d is %.3f, want the adjacent model to match", tc.q, tc.other, s)
+		}
+		if s, _ := fuzzyOf(t, strict, tc.q, tc.other); s != 0 {
+			t.Errorf("%q: strict fuzzy for product %d is %.3f, want 0", tc.q, tc.other, s)
+		}
+		if s, _ := fuzzyOf(t, strict, tc.q, tc.want); s == 0 {
+			t.Errorf("%q: strict fuzzy for product %d is 0, want a match", tc.q, tc.want)
+		}
+	}
+}
+
+func TestCombinedBoostSeparatesAdjacentModels(t *testing.T) {
+	cfg := DefaultConfig(0.7, 0.3)
+	cfg.CombinedBoost = 0.2
+	ix, _ := newTestIndex(t, cfg, testCatalog())
+
+	brands := map[uint]string{1: "samsung", 2: "samsung", 3: "apple", 4: "apple"}
+	for _, tc := range adjacentModels {
+		for _, q := range []string{tc.q, brands[tc.want] + " " + tc.q} {
+			res, err := ix.Search(context.Background(), q, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			boosted := map[uint]bool{}
+			for _, r := range res {
+				if _, ok := r.Boosts["combined"]; ok {
+					boosted[r.Product.ID] = true
+				}
+			}
+			if !boosted[tc.want] || boosted[tc.other] {
+				t.Errorf("%q: combined boost on %v, want product %d and not %d", q, boosted, tc.want, tc.other)
+			}
+			if len(res) == 0 || res[0].Product.ID != tc.want {
+				t.Errorf("%q: top result %v, want product %d", q, res, tc.want)
+			}
+		}
+	}
+}
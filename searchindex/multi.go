@@ -0,0 +1,64 @@
+package searchindex
+
+import (
+	"context"
+	"fmt"
+)
+
+// WeightedQuery is one phrasing in a SearchMulti and how much it counts.
+type WeightedQuery struct {
+	Text   string
+	Weight float64
+}
+
+// SearchMulti searches for several phrasings of one need at once, such as a
+// rewriter's primary query and its alternatives, in a single scoring pass.
+// Each query is embedded (through the query cache) and the unit vectors are
+// averaged by weight into one query vector; fuzzy matching, hints and boosts
+// use the highest-weighted query. Queries with no positive weight are
+// skipped.
+//
+// Compared with merging separate searches by best score, this scores the
+// corpus once instead of once per query and favours products close to every
+// phrasing. Its weakness is queries with unrelated meanings ("apple" the
+// fruit and the brand): their centroid can sit near neither, where merging
+// keeps each meaning's best hits.
+func (ix *Index) SearchMulti(ctx context.Context, queries []WeightedQuery, topK int) ([]SearchResult, error) {
+	return ix.SearchMultiWithOptions(ctx, queries, topK, SearchOptions{})
+}
+
+// SearchMultiWithOptions is SearchMulti with per-request options.
+func (ix *Index) SearchMultiWithOptions(ctx context.Context, queries []WeightedQuery, topK int, opts SearchOptions) ([]SearchResult, error) {
+	var primary WeightedQuery
+	for _, wq := range queries {
+		if wq.Weight > primary.Weight && parseHints(wq.Text).text != "" {
+			primary = wq
+		}
+	}
+	if primary.Weight <= 0 {
+		return nil, ErrEmptyQuery
+	}
+	cfg := ix.Config()
+	var centroid []float32
+	for _, wq := range queries {
+		text := parseHints(wq.Text).text
+		if wq.Weight <= 0 || text == "" {
+			continue
+		}
+		vec, err := ix.embedQuery(ctx, text, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if centroid == nil {
+			centroid = make([]float32, len(vec))
+		} else if len(vec) != len(centroid) {
+			return nil, fmt.Errorf("%w: query %q has %d dimensions, want %d",
+				ErrDimensionMismatch, wq.Text, len(vec), len(centroid))
+		}
+		for i, x := range unitVector(vec) {
+			centroid[i] += float32(wq.Weight) * x
+		}
+	}
+	opts.queryVec = centroid
+	return ix.SearchWithOptions(ctx, primary.Text, topK, opts)
+}
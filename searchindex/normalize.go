@@ -0,0 +1,111 @@
+package searchindex
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization steps accepted in Config.FieldNormalization.
+const (
+	NormLowercase   = "lowercase"
+	NormFoldAccents = "fold"
+	NormStopWords   = "stopwords"
+	NormStem        = "stem"
+)
+
+var normSteps = []string{NormLowercase, NormFoldAccents, NormStopWords, NormStem}
+
+// DefaultFieldNormalization is the pipeline DefaultConfig uses for each
+// field: brands only ignore case, titles also ignore accents, and
+// descriptions drop stop words and plural endings as well.
+var DefaultFieldNormalization = map[string][]string{
+	FieldTitle:       {NormLowercase, NormFoldAccents},
+	FieldBrand:       {NormLowercase},
+	FieldDescription: {NormLowercase, NormFoldAccents, NormStopWords, NormStem},
+}
+
+// normalizer runs one field's Config.FieldNormalization pipeline.
+type normalizer struct {
+	steps []string
+	tok   Tokenizer
+	stop  map[string]bool
+}
+
+// normalizers returns the pipeline of each field that has one.
+func (c Config) normalizers() map[string]normalizer {
+	if len(c.FieldNormalization) == 0 {
+		return nil
+	}
+	stop := make(map[string]bool, len(c.StopWords))
+	for _, w := range c.StopWords {
+		stop[strings.ToLower(strings.TrimSpace(w))] = true
+	}
+	out := make(map[string]normalizer, len(c.FieldNormalization))
+	for field, steps := range c.FieldNormalization {
+		if len(steps) > 0 {
+			out[field] = normalizer{steps: steps, tok: c.tokenizer(), stop: stop}
+		}
+	}
+	return out
+}
+
+// apply runs the steps over s in order. The word-level steps rejoin the
+// tokenizer's words with single spaces, dropping punctuation.
+func (n normalizer) apply(s string) string {
+	for _, step := range n.steps {
+		switch step {
+		case NormLowercase:
+			s = strings.ToLower(s)
+		case NormFoldAccents:
+			s = foldAccents(s)
+		case NormStopWords:
+			var kept []string
+			for _, w := range words(n.tok, s) {
+				if !n.stop[w] {
+					kept = append(kept, w)
+				}
+			}
+			s = strings.Join(kept, " ")
+		case NormStem:
+			ws := words(n.tok, s)
+			for i, w := range ws {
+				ws[i] = stem(w)
+			}
+			s = strings.Join(ws, " ")
+		}
+	}
+	return s
+}
+
+// foldAccents strips combining marks, so "Café Crème" is "Cafe Creme".
+func foldAccents(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	out, _, err := transform.String(t, s)
+	if err != nil {
+		return s
+	}
+	return out
+}
+
+// stem removes English plural endings with the S-stemmer rules:
+// "batteries" is "battery", "cases" is "case", "cables" is "cable", while
+// "glass" and "status" are kept. Short words and words with digits, like
+// model numbers, are left alone.
+func stem(w string) string {
+	if len(w) <= 3 || strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+		return w
+	}
+	switch {
+	case strings.HasSuffix(w, "ies") && !strings.HasSuffix(w, "eies") && !strings.HasSuffix(w, "aies"):
+		return w[:len(w)-3] + "y"
+	case strings.HasSuffix(w, "es") && !strings.HasSuffix(w, "aes") && !strings.HasSuffix(w, "ees") && !strings.HasSuffix(w, "oes"):
+		return w[:len(w)-1]
+	case strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "us") && !strings.HasSuffix(w, "ss"):
+		return w[:len(w)-1]
+	}
+	return w
+}
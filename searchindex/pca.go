@@ -0,0 +1,170 @@
+package searchindex
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// PCA settings. Fitting samples at most pcaSample vectors, which is plenty
+// to find the main directions of a catalog, and runs pcaIterations rounds
+// of subspace iteration on their covariance.
+const (
+	pcaSample     = 10000
+	pcaIterations = 30
+)
+
+// projection maps embeddings onto the top principal components of a
+// corpus; see Config.PCADimensions.
+type projection struct {
+	Mean       []float32
+	Components [][]float32 // orthonormal rows
+}
+
+// in and out are the input and output vector lengths.
+func (p *projection) in() int  { return len(p.Mean) }
+func (p *projection) out() int { return len(p.Components) }
+
+// apply projects v, centered on the corpus mean, onto the components and
+// returns the result as a unit vector. Vectors that aren't of the input
+// length are returned unchanged, so already projected ones pass through.
+func (p *projection) apply(v []float32) []float32 {
+	if p == nil || len(v) != p.in() {
+		return v
+	}
+	out := make([]float32, p.out())
+	for j, c := range p.Components {
+		var s float64
+		for i, x := range v {
+			s += float64(c[i]) * float64(x-p.Mean[i])
+		}
+		out[j] = float32(s)
+	}
+	return unitVector(out)
+}
+
+// fitPCA finds the k directions along which vecs vary most. It returns
+// nil when there is nothing to reduce: no vectors, or k not below their
+// length.
+func fitPCA(vecs [][]float32, k int) *projection {
+	if len(vecs) == 0 || k <= 0 || k >= len(vecs[0]) {
+		return nil
+	}
+	d := len(vecs[0])
+	if len(vecs) > pcaSample {
+		sample := make([][]float32, pcaSample)
+		for i := range sample {
+			sample[i] = vecs[i*len(vecs)/pcaSample]
+		}
+		vecs = sample
+	}
+
+	mean := make([]float64, d)
+	for _, v := range vecs {
+		for i, x := range v {
+			mean[i] += float64(x)
+		}
+	}
+	for i := range mean {
+		mean[i] /= float64(len(vecs))
+	}
+	// Covariance, accumulated in the upper triangle and mirrored.
+	cov := make([]float64, d*d)
+	c := make([]float64, d)
+	for _, v := range vecs {
+		for i, x := range v {
+			c[i] = float64(x) - mean[i]
+		}
+		for i, ci := range c {
+			if ci == 0 {
+				continue
+			}
+			row := cov[i*d:]
+			for j := i; j < d; j++ {
+				row[j] += ci * c[j]
+			}
+		}
+	}
+	for i := range d {
+		for j := i + 1; j < d; j++ {
+			cov[j*d+i] = cov[i*d+j]
+		}
+	}
+
+	// Subspace iteration: V converges to the span of the top k
+	// eigenvectors. Any orthonormal basis of that span preserves dot
+	// products within it, so the order of the rows doesn't matter.
+	rng := rand.New(rand.NewPCG(1, 2)) // fixed, so fits are reproducible
+	basis := make([][]float64, k)
+	for j := range basis {
+		basis[j] = randomVec(rng, d)
+	}
+	orthonormalize(basis, rng)
+	next := make([][]float64, k)
+	for range pcaIterations {
+		for j, b := range basis {
+			w := make([]float64, d)
+			for i := range d {
+				row := cov[i*d : (i+1)*d]
+				var s float64
+				for l, x := range row {
+					s += x * b[l]
+				}
+				w[i] = s
+			}
+			next[j] = w
+		}
+		basis, next = next, basis
+		orthonormalize(basis, rng)
+	}
+
+	p := &projection{Mean: make([]float32, d), Components: make([][]float32, k)}
+	for i, m := range mean {
+		p.Mean[i] = float32(m)
+	}
+	for j, b := range basis {
+		p.Components[j] = make([]float32, d)
+		for i, x := range b {
+			p.Components[j][i] = float32(x)
+		}
+	}
+	return p
+}
+
+// orthonormalize applies Gram-Schmidt to vs in place. A vector that
+// vanishes, as happens when the data spans fewer than len(vs) directions,
+// is replaced by a random one.
+func orthonormalize(vs [][]float64, rng *rand.Rand) {
+	for j := 0; j < len(vs); j++ {
+		v := vs[j]
+		for _, u := range vs[:j] {
+			var s float64
+			for i := range v {
+				s += v[i] * u[i]
+			}
+			for i := range v {
+				v[i] -= s * u[i]
+			}
+		}
+		var n float64
+		for _, x := range v {
+			n += x * x
+		}
+		n = math.Sqrt(n)
+		if n < 1e-9 {
+			vs[j] = randomVec(rng, len(v))
+			j-- // orthogonalize the replacement too
+			continue
+		}
+		for i := range v {
+			v[i] /= n
+		}
+	}
+}
+
+func randomVec(rng *rand.Rand, d int) []float64 {
+	v := make([]float64, d)
+	for i := range v {
+		v[i] = rng.NormFloat64()
+	}
+	return v
+}
@@ -0,0 +1,91 @@
+package searchindex
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+)
+
+func pcaCatalog() []Product {
+	var ps []Product
+	for i, w := range []string{"phone", "laptop", "camera", "shoes", "wallet", "watch", "tablet", "headphones"} {
+		for j := range 4 {
+			ps = append(ps, Product{
+				ID:          uint(i*4 + j + 1),
+				Title:       fmt.Sprintf("%s model %d", w, j),
+				Description: fmt.Sprintf("a %s for everyday use, series %d", w, j%2),
+			})
+		}
+	}
+	return ps
+}
+
+func TestPCAProjectsQueriesLikeDocuments(t *testing.T) {
+	cfg := DefaultConfig(1, 0)
+	cfg.PCADimensions = 8
+	ix, em := newTestIndex(t, cfg, pcaCatalog())
+	if ix.proj == nil || ix.proj.out() != 8 {
+		t.Fatalf("projection not fitted: %+v", ix.proj)
+	}
+	if got := len(ix.docs[0].Embedding); got != 8 {
+		t.Fatalf("stored vectors have %d dimensions, want 8", got)
+	}
+
+	const q = "camera for everyday use"
+	results, err := ix.Search(context.Background(), q, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := em.Embed(context.Background(), q)
+	qVec := ix.proj.apply(unitVector(raw))
+	for _, r := range results {
+		d := ix.docs[ix.byID[r.Product.ID]]
+		want := dot(qVec, d.Embedding)
+		if got := r.Why[SignalSemantic]; math.Abs(got-want) > 1e-6 {
+			t.Errorf("product %d: semantic %v in index, %v from projected query", r.Product.ID, got, want)
+		}
+	}
+}
+
+func TestPCASurvivesSnapshot(t *testing.T) {
+	cfg := DefaultConfig(1, 0)
+	cfg.PCADimensions = 8
+	ix, _ := newTestIndex(t, cfg, pcaCatalog())
+
+	for _, codec := range []IndexCodec{GobCodec{}, JSONCodec{}} {
+		var buf bytes.Buffer
+		if err := ix.Save(&buf, codec); err != nil {
+			t.Fatalf("%T Save: %v", codec, err)
+		}
+		loaded := NewWithEmbedder(&fakeEmbedder{}, "fake", 1, 0)
+		if err := loaded.SetConfig(cfg); err != nil {
+			t.Fatal(err)
+		}
+		if err := loaded.Load(&buf, codec); err != nil {
+			t.Fatalf("%T Load: %v", codec, err)
+		}
+		if loaded.proj == nil || !slices.Equal(loaded.proj.Mean, ix.proj.Mean) {
+			t.Fatalf("%T: projection not restored", codec)
+		}
+		for i, d := range ix.docs {
+			if !slices.Equal(loaded.docs[i].Embedding, d.Embedding) {
+				t.Fatalf("%T: product %d vector changed in round trip", codec, d.P.ID)
+			}
+		}
+
+		want, _ := ix.Search(context.Background(), "laptop model 2", 5)
+		got, err := loaded.Search(context.Background(), "laptop model 2", 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range want {
+			if got[i].Product.ID != want[i].Product.ID || math.Abs(got[i].Score-want[i].Score) > 1e-9 {
+				t.Errorf("%T: rank %d is %d (%v) after Load, want %d (%v)", codec, i,
+					got[i].Product.ID, got[i].Score, want[i].Product.ID, want[i].Score)
+			}
+		}
+	}
+}
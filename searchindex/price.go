@@ -0,0 +1,149 @@
+package searchindex
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PriceRange is a price constraint stated in a query, such as "under
+// 50000" or "between 200 and 500". Phrase is the text it was read from.
+type PriceRange struct {
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Phrase string   `json:"phrase"`
+}
+
+// priceBounds maps the words that introduce a single price bound to
+// whether it is an upper bound, and how many words the phrase takes.
+var priceBounds = []struct {
+	words []string
+	upper bool
+}{
+	{[]string{"under"}, true},
+	{[]string{"below"}, true},
+	{[]string{"upto"}, true},
+	{[]string{"up", "to"}, true},
+	{[]string{"within"}, true},
+	{[]string{"less", "than"}, true},
+	{[]string{"cheaper", "than"}, true},
+	{[]string{"over"}, false},
+	{[]string{"above"}, false},
+	{[]string{"more", "than"}, false},
+	{[]string{"costlier", "than"}, false},
+}
+
+// currencyWords may come before or after an amount: "rs 500", "500 rupees".
+var currencyWords = map[string]bool{
+	"rs": true, "rs.": true, "inr": true, "rupees": true, "rupee": true,
+	"usd": true, "dollars": true, "dollar": true, "bucks": true,
+}
+
+// unitWords after an amount mean it isn't a price, as in "under 7 inch".
+var unitWords = map[string]bool{
+	"inch": true, "inches": true, "in": true, "cm": true, "mm": true,
+	"gb": true, "tb": true, "mb": true, "mp": true, "mah": true,
+	"hz": true, "w": true, "kg": true, "g": true, "l": true, "ml": true,
+}
+
+// ParsePriceRange finds the first price phrase in q: "under X", "below X",
+// "up to X", "less than X", "over X", "above X", "more than X" or "between
+// X and Y". Amounts may carry a currency sign or word and a "k" for
+// thousands ("₹50k", "rs 50,000"). An amount followed by a unit such as
+// "inch" or "gb" isn't a price. It returns q without the phrase, and
+// false when q has none.
+func ParsePriceRange(q string) (string, PriceRange, bool) {
+	toks := strings.Fields(q)
+	lower := make([]string, len(toks))
+	for i, t := range toks {
+		lower[i] = strings.ToLower(t)
+	}
+	for i := range toks {
+		var pr PriceRange
+		end := 0
+		if lower[i] == "between" {
+			lo, j, ok := priceAt(lower, i+1)
+			if ok && j < len(lower) && (lower[j] == "and" || lower[j] == "to") {
+				if hi, k, ok := priceAt(lower, j+1); ok && lo <= hi {
+					pr.Min, pr.Max, end = &lo, &hi, k
+				}
+			}
+		} else {
+			for _, b := range priceBounds {
+				if !hasWordsAt(lower, i, b.words) {
+					continue
+				}
+				if v, j, ok := priceAt(lower, i+len(b.words)); ok {
+					if b.upper {
+						pr.Max = &v
+					} else {
+						pr.Min = &v
+					}
+					end = j
+				}
+				break
+			}
+		}
+		if end == 0 {
+			continue
+		}
+		pr.Phrase = strings.Join(toks[i:end], " ")
+		rest := append(append([]string{}, toks[:i]...), toks[end:]...)
+		return strings.Join(rest, " "), pr, true
+	}
+	return q, PriceRange{}, false
+}
+
+func hasWordsAt(toks []string, i int, words []string) bool {
+	if i+len(words) > len(toks) {
+		return false
+	}
+	for k, w := range words {
+		if toks[i+k] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// priceAt reads an amount starting at toks[i], with an optional currency
+// word on either side, and returns it and the index after it.
+func priceAt(toks []string, i int) (float64, int, bool) {
+	if i < len(toks) && currencyWords[toks[i]] {
+		i++
+	}
+	if i >= len(toks) {
+		return 0, 0, false
+	}
+	v, ok := parseAmount(toks[i])
+	if !ok {
+		return 0, 0, false
+	}
+	i++
+	if i < len(toks) {
+		switch {
+		case currencyWords[toks[i]]:
+			i++
+		case unitWords[toks[i]]:
+			return 0, 0, false
+		}
+	}
+	return v, i, true
+}
+
+// parseAmount parses "50000", "50,000", "₹50000", "$49.99" or "50k".
+func parseAmount(s string) (float64, bool) {
+	for _, sign := range []string{"₹", "$", "€", "£", "rs.", "rs"} {
+		s = strings.TrimPrefix(s, sign)
+	}
+	s = strings.ReplaceAll(s, ",", "")
+	scale := 1.0
+	if k, ok := strings.CutSuffix(s, "k"); ok {
+		s, scale = k, 1000
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(v > 0) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v * scale, true
+}
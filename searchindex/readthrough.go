@@ -0,0 +1,72 @@
+package searchindex
+
+import (
+	"context"
+	"sync"
+)
+
+// ProductFetcher reads a single product from the catalog's source of truth.
+// A Loader can implement it to support ReadThrough.
+type ProductFetcher interface {
+	// Product returns the product with the given ID, or false if the
+	// source doesn't have it either.
+	Product(ctx context.Context, id uint) (Product, bool, error)
+}
+
+// readThrough deduplicates concurrent ReadThrough fetches per product.
+type readThrough struct {
+	mu       sync.Mutex
+	inflight map[uint]*fetchCall
+}
+
+type fetchCall struct {
+	done  chan struct{}
+	found bool
+	err   error
+}
+
+// ReadThrough makes sure product id is searchable during sync lag: if it
+// isn't indexed it is fetched from f and upserted. It reports whether the
+// product is indexed afterwards. Concurrent calls for the same ID share one
+// fetch, so a burst of requests for a new product costs one source read and
+// one embedding call.
+func (ix *Index) ReadThrough(ctx context.Context, f ProductFetcher, id uint) (bool, error) {
+	if ix.Contains(id) {
+		return true, nil
+	}
+	rt := &ix.readThrough
+	rt.mu.Lock()
+	if c, ok := rt.inflight[id]; ok {
+		rt.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.found, c.err
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	c := &fetchCall{done: make(chan struct{})}
+	if rt.inflight == nil {
+		rt.inflight = map[uint]*fetchCall{}
+	}
+	rt.inflight[id] = c
+	rt.mu.Unlock()
+
+	c.found, c.err = ix.fetchAndUpsert(ctx, f, id)
+	rt.mu.Lock()
+	delete(rt.inflight, id)
+	rt.mu.Unlock()
+	close(c.done)
+	return c.found, c.err
+}
+
+func (ix *Index) fetchAndUpsert(ctx context.Context, f ProductFetcher, id uint) (bool, error) {
+	p, ok, err := f.Product(ctx, id)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := ix.Upsert(ctx, []Product{p}); err != nil {
+		return false, err
+	}
+	return ix.Contains(id), nil
+}
@@ -0,0 +1,58 @@
+package searchindex
+
+// fieldSet records which fields a vocabulary word occurs in.
+type fieldSet uint8
+
+const (
+	inTitle       fieldSet = 1 << iota // title or brand
+	inDescription                      // description
+)
+
+// buildVocab maps every indexed word to the fields it appears in.
+func buildVocab(docs []productDoc, tok Tokenizer) map[string]fieldSet {
+	vocab := map[string]fieldSet{}
+	for _, d := range docs {
+		for _, w := range words(tok, d.P.Title+" "+d.P.Brand) {
+			vocab[w] |= inTitle
+		}
+		for _, w := range words(tok, d.P.Description) {
+			vocab[w] |= inDescription
+		}
+	}
+	return vocab
+}
+
+// routeLocked guesses which field a query targets: words found only in
+// titles and brands ("sony") route to the title vector, words found only in
+// descriptions ("waterproof") to the description vector. It returns "" when
+// the evidence is mixed or absent. The caller holds ix.mu.
+func (ix *Index) routeLocked(qWords []string) string {
+	var title, desc int
+	for _, w := range qWords {
+		switch ix.vocab[w] {
+		case inTitle:
+			title++
+		case inDescription:
+			desc++
+		}
+	}
+	switch {
+	case title > desc:
+		return FieldTitle
+	case desc > title:
+		return FieldDescription
+	}
+	return ""
+}
+
+// routedEmbedding returns the vector to compare against for route, falling
+// back to the combined embedding when the field has none.
+func (d productDoc) routedEmbedding(route string) []float32 {
+	switch {
+	case route == FieldTitle && d.TitleEmbedding != nil:
+		return d.TitleEmbedding
+	case route == FieldDescription && d.DescriptionEmbedding != nil:
+		return d.DescriptionEmbedding
+	}
+	return d.Embedding
+}
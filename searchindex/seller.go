@@ -0,0 +1,30 @@
+package searchindex
+
+import "math"
+
+// SetSellerBoosts replaces the per-seller score multipliers, keyed by
+// Product.SellerID, for sponsored or preferred sellers: 1.2 lifts a
+// seller's products by 20%, 0.9 demotes them by 10%. Non-positive,
+// infinite and NaN multipliers are dropped, and sellers without one are
+// left alone. The lift is applied after relevance scoring and shows up
+// in SearchResult.Boosts as "seller". It takes effect on the next search
+// without a rebuild and, since it changes rankings, advances the
+// Generation; nil clears the boosts.
+//
+// Boosts trade relevance for placement: a large multiplier can put a
+// boosted seller's weak match above another seller's exact one. Keep
+// multipliers small, label the results as sponsored where the
+// marketplace's rules require it, and combine with Config.MaxPerSeller so
+// a boosted seller can't fill the first page.
+func (ix *Index) SetSellerBoosts(boosts map[uint]float64) {
+	clean := make(map[uint]float64, len(boosts))
+	for id, m := range boosts {
+		if m > 0 && !math.IsInf(m, 0) {
+			clean[id] = m
+		}
+	}
+	ix.mu.Lock()
+	ix.sellerBoosts = clean
+	ix.generation++
+	ix.mu.Unlock()
+}
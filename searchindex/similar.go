@@ -0,0 +1,49 @@
+package searchindex
+
+// Similar returns the k products whose embeddings are closest to product
+// id, excluding the product itself. It uses stored embeddings only, so no
+// embedding API calls are made. k <= 0 returns every other product.
+func (ix *Index) Similar(id uint, k int) ([]SearchResult, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	i, ok := ix.byID[id]
+	if !ok {
+		return nil, ErrNotIndexed
+	}
+	return ix.similarLocked(i, k), nil
+}
+
+// SimilarBatch runs Similar for every id under a single read lock. IDs that
+// aren't indexed are left out of the returned map.
+func (ix *Index) SimilarBatch(ids []uint, k int) map[uint][]SearchResult {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	out := make(map[uint][]SearchResult, len(ids))
+	for _, id := range ids {
+		if i, ok := ix.byID[id]; ok {
+			out[id] = ix.similarLocked(i, k)
+		}
+	}
+	return out
+}
+
+// similarLocked ranks every doc against docs[i]. The caller holds ix.mu.
+func (ix *Index) similarLocked(i, k int) []SearchResult {
+	src := ix.docs[i]
+	results := make([]SearchResult, 0, len(ix.docs)-1)
+	for j, d := range ix.docs {
+		if j == i {
+			continue
+		}
+		var r SearchResult
+		r.Product = d.P
+		r.Score = dot(src.Embedding, d.Embedding)
+		r.Why = map[string]float64{SignalSemantic: r.Score}
+		results = append(results, r)
+	}
+	SortResults(results, ix.cfg.Tiebreakers)
+	if k > 0 && k < len(results) {
+		results = results[:k]
+	}
+	return results
+}
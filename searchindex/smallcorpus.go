@@ -0,0 +1,37 @@
+package searchindex
+
+import "maps"
+
+// small reports whether an index of n products falls under
+// Config.SmallCorpus.
+func (c Config) small(n int) bool {
+	return n > 0 && n < c.SmallCorpus
+}
+
+// forCorpus returns c adjusted for an index of n products; see
+// Config.SmallCorpus.
+func (c Config) forCorpus(n int) Config {
+	if !c.small(n) {
+		return c
+	}
+	c.MaxDocFreq = 0
+	if len(c.SmallCorpusWeights) > 0 {
+		w := maps.Clone(c.Weights)
+		if w == nil {
+			w = make(map[string]float64, len(c.SmallCorpusWeights))
+		}
+		maps.Copy(w, c.SmallCorpusWeights)
+		c.Weights = w
+	}
+	return c
+}
+
+// SmallCorpus reports whether the index holds fewer products than
+// Config.SmallCorpus, so scores are worth reading with care: over a
+// handful of products semantic similarities barely differ and fuzzy
+// matching decides the ranking.
+func (ix *Index) SmallCorpus() bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.cfg.small(len(ix.docs))
+}
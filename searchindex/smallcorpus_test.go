@@ -0,0 +1,138 @@
+package searchindex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smallCorpusOptions exercises every SearchOptions field.
+func smallCorpusOptions() map[string]SearchOptions {
+	low, high := 50.0, 5.0
+	return map[string]SearchOptions{
+		"zero":      {},
+		"context":   {Context: []string{"phones"}},
+		"flags":     {Flags: map[string]string{FlagBlend: BlendRRF, FlagBrandBoost: "0.2"}},
+		"explain":   {Explain: true},
+		"status":    {Filter: Filter{Statuses: []int{1}}},
+		"category":  {Filter: Filter{CategoryIDs: []uint{9}}},
+		"minPrice":  {Filter: Filter{MinPrice: &low}},
+		"maxPrice":  {Filter: Filter{MaxPrice: &high}},
+		"recency":   {Filter: Filter{CreatedAfter: time.Now()}},
+		"minScore":  {Filter: Filter{MinScore: 0.99}},
+		"seed":      {Seed: 7},
+		"sort":      {Sort: SortPrice + sortDescSuffix},
+		"allFilter": {Filter: Filter{Statuses: []int{0}, MinPrice: &high, MinScore: 0.01}},
+	}
+}
+
+func smallCorpusConfig() Config {
+	cfg := DefaultConfig(0.7, 0.3)
+	cfg.SmallCorpus = 5
+	cfg.SmallCorpusWeights = map[string]float64{SignalFuzzy: 0.6}
+	cfg.ContextWeight = 0.3
+	cfg.MaxDocFreq = 0.5
+	cfg.MaxPerSeller = 1
+	cfg.ShuffleEpsilon = 0.05
+	cfg.MinResults = 1
+	cfg.Relaxation = []string{ExcludedMinScore}
+	return cfg
+}
+
+// pageSize is the SearchPage page size to use with opts: sorted results
+// only come as one page.
+func pageSize(opts SearchOptions) int {
+	if opts.Sort != "" {
+		return 0
+	}
+	return 2
+}
+
+func TestSearchEmptyIndex(t *testing.T) {
+	ix, _ := newTestIndex(t, smallCorpusConfig(), nil)
+	if ix.SmallCorpus() {
+		t.Error("an empty index reports SmallCorpus")
+	}
+	for name, opts := range smallCorpusOptions() {
+		for _, topK := range []int{0, 1, 10} {
+			res, err := ix.SearchWithOptions(context.Background(), "galaxy phone", topK, opts)
+			if !errors.Is(err, ErrIndexEmpty) || len(res) != 0 {
+				t.Errorf("%s, topK %d: got %d results, %v; want ErrIndexEmpty", name, topK, len(res), err)
+			}
+		}
+		if _, _, err := ix.SearchPage(context.Background(), "galaxy phone", pageSize(opts), "", opts); !errors.Is(err, ErrIndexEmpty) {
+			t.Errorf("%s: SearchPage: %v, want ErrIndexEmpty", name, err)
+		}
+	}
+	if _, err := ix.Similar(1, 10); !errors.Is(err, ErrNotIndexed) {
+		t.Errorf("Similar: %v, want ErrNotIndexed", err)
+	}
+	if ex, err := ix.Explain(context.Background(), "galaxy", 1, SearchOptions{}); err != nil || ex.Indexed {
+		t.Errorf("Explain: %+v, %v", ex, err)
+	}
+}
+
+func TestSearchOneDocIndex(t *testing.T) {
+	p := Product{ID: 1, Title: "Galaxy S23", Brand: "Samsung", Description: "Android phone", Price: 20, Status: 1, CategoryID: 9, CreatedAt: time.Now().Add(-time.Hour)}
+	ix, _ := newTestIndex(t, smallCorpusConfig(), []Product{p})
+	if !ix.SmallCorpus() {
+		t.Error("a one-product index doesn't report SmallCorpus")
+	}
+	// Filters the product fails leave nothing; the rest return it alone
+	// whatever topK is. minScore is relaxed back in, and the high price
+	// bound plus minScore in allFilter drop it.
+	empty := map[string]bool{"minPrice": true, "maxPrice": true, "recency": true, "allFilter": true}
+	for name, opts := range smallCorpusOptions() {
+		for _, topK := range []int{0, 1, 10} {
+			res, err := ix.SearchWithOptions(context.Background(), "galaxy phone", topK, opts)
+			if err != nil {
+				t.Errorf("%s, topK %d: %v", name, topK, err)
+				continue
+			}
+			want := 1
+			if empty[name] {
+				want = 0
+			}
+			if len(res) != want {
+				t.Errorf("%s, topK %d: got %d results, want %d", name, topK, len(res), want)
+			}
+			if len(res) == 1 && res[0].Product.ID != 1 {
+				t.Errorf("%s, topK %d: got product %d", name, topK, res[0].Product.ID)
+			}
+		}
+		page, next, err := ix.SearchPage(context.Background(), "galaxy phone", pageSize(opts), "", opts)
+		if err != nil || next != "" || len(page) > 1 {
+			t.Errorf("%s: SearchPage: %d results, next %q, %v", name, len(page), next, err)
+		}
+	}
+	if res, err := ix.Similar(1, 10); err != nil || len(res) != 0 {
+		t.Errorf("Similar: %d results, %v; want none", len(res), err)
+	}
+	if ex, err := ix.Explain(context.Background(), "galaxy phone", 1, SearchOptions{}); err != nil || ex.Rank != 1 {
+		t.Errorf("Explain: %+v, %v; want rank 1", ex, err)
+	}
+}
+
+func TestSmallCorpusWarnsOnRebuildOnly(t *testing.T) {
+	var buf bytes.Buffer
+	old := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(old)
+
+	ix, _ := newTestIndex(t, smallCorpusConfig(), testCatalog()[:2])
+	if !strings.Contains(buf.String(), "under smallCorpus") {
+		t.Fatalf("Rebuild didn't warn; log: %q", buf.String())
+	}
+	buf.Reset()
+	if err := ix.Upsert(context.Background(), testCatalog()[2:3]); err != nil {
+		t.Fatal(err)
+	}
+	ix.Delete(1)
+	if buf.Len() > 0 {
+		t.Errorf("patches logged: %q", buf.String())
+	}
+}
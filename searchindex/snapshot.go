@@ -0,0 +1,183 @@
+package searchindex
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// snapshotVersion is bumped whenever the snapshot layout changes.
+const snapshotVersion = 1
+
+// SnapshotHeader identifies what a snapshot was built with.
+type SnapshotHeader struct {
+	Version    int    `json:"version"`
+	Model      string `json:"model"`
+	Dimensions int    `json:"dimensions"`
+	Count      int    `json:"count"`
+}
+
+// SnapshotDoc is one indexed product with its vectors.
+type SnapshotDoc struct {
+	Product              Product           `json:"product"`
+	SearchText           string            `json:"searchText"`
+	Hash                 [sha256.Size]byte `json:"hash"`
+	Embedding            []float32         `json:"embedding"`
+	TitleEmbedding       []float32         `json:"titleEmbedding,omitempty"`
+	DescriptionEmbedding []float32         `json:"descriptionEmbedding,omitempty"`
+	ImageEmbedding       []float32         `json:"imageEmbedding,omitempty"`
+}
+
+// Snapshot is the persisted form of an Index, written by Save and read by
+// Load through an IndexCodec.
+type Snapshot struct {
+	Header SnapshotHeader `json:"header"`
+	Docs   []SnapshotDoc  `json:"docs"`
+	// Projection is the PCA projection the vectors were reduced with,
+	// nil when they are full size; see Config.PCADimensions.
+	Projection *SnapshotProjection `json:"projection,omitempty"`
+}
+
+// SnapshotProjection is a PCA projection: the mean of the full-size
+// vectors and the orthonormal components they are projected onto.
+type SnapshotProjection struct {
+	Mean       []float32   `json:"mean"`
+	Components [][]float32 `json:"components"`
+}
+
+// IndexCodec encodes snapshots in some format. GobCodec and JSONCodec are
+// provided; implement it for other tradeoffs, e.g. a raw binary layout.
+type IndexCodec interface {
+	Encode(w io.Writer, s *Snapshot) error
+	Decode(r io.Reader) (*Snapshot, error)
+}
+
+// GobCodec stores snapshots compactly with encoding/gob.
+type GobCodec struct{}
+
+func (GobCodec) Encode(w io.Writer, s *Snapshot) error { return gob.NewEncoder(w).Encode(s) }
+
+func (GobCodec) Decode(r io.Reader) (*Snapshot, error) {
+	var s Snapshot
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// JSONCodec stores snapshots as JSON, which is larger and slower but easy
+// to inspect.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(w io.Writer, s *Snapshot) error { return json.NewEncoder(w).Encode(s) }
+
+func (JSONCodec) Decode(r io.Reader) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Save writes the indexed corpus and its vectors to w, so a restart can
+// Load it instead of re-embedding everything.
+func (ix *Index) Save(w io.Writer, codec IndexCodec) error {
+	ix.mu.RLock()
+	s := &Snapshot{
+		Header: SnapshotHeader{Version: snapshotVersion, Model: ix.modelName, Count: len(ix.docs)},
+		Docs:   make([]SnapshotDoc, len(ix.docs)),
+	}
+	if len(ix.docs) > 0 {
+		s.Header.Dimensions = len(ix.docs[0].Embedding)
+	}
+	if ix.proj != nil {
+		s.Projection = &SnapshotProjection{Mean: ix.proj.Mean, Components: ix.proj.Components}
+	}
+	for i, d := range ix.docs {
+		s.Docs[i] = SnapshotDoc{
+			Product:              d.P,
+			SearchText:           d.SearchText,
+			Hash:                 d.Hash,
+			Embedding:            d.Embedding,
+			TitleEmbedding:       d.TitleEmbedding,
+			DescriptionEmbedding: d.DescriptionEmbedding,
+			ImageEmbedding:       d.ImageEmbedding,
+		}
+	}
+	ix.mu.RUnlock()
+	return codec.Encode(w, s)
+}
+
+// Load replaces the indexed corpus with a snapshot from Save. Snapshots
+// from another embedding model, or whose vectors don't match the header,
+// are rejected with ErrSnapshotMismatch and leave the index unchanged.
+func (ix *Index) Load(r io.Reader, codec IndexCodec) error {
+	s, err := codec.Decode(r)
+	if err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	h := s.Header
+	switch {
+	case h.Version != snapshotVersion:
+		return fmt.Errorf("%w: version %d, want %d", ErrSnapshotMismatch, h.Version, snapshotVersion)
+	case h.Model != ix.modelName:
+		return fmt.Errorf("%w: built with model %q, index uses %q", ErrSnapshotMismatch, h.Model, ix.modelName)
+	case h.Count != len(s.Docs):
+		return fmt.Errorf("%w: header lists %d products, snapshot has %d", ErrSnapshotMismatch, h.Count, len(s.Docs))
+	}
+	var proj *projection
+	if sp := s.Projection; sp != nil {
+		if len(sp.Components) != h.Dimensions {
+			return fmt.Errorf("%w: projection has %d components, header says %d dimensions",
+				ErrSnapshotMismatch, len(sp.Components), h.Dimensions)
+		}
+		for _, c := range sp.Components {
+			if len(c) != len(sp.Mean) {
+				return fmt.Errorf("%w: projection component has %d dimensions, mean has %d",
+					ErrSnapshotMismatch, len(c), len(sp.Mean))
+			}
+		}
+		proj = &projection{Mean: sp.Mean, Components: sp.Components}
+	}
+	docs := make([]productDoc, len(s.Docs))
+	byID := make(map[uint]int, len(s.Docs))
+	for i, sd := range s.Docs {
+		if len(sd.Embedding) != h.Dimensions {
+			return fmt.Errorf("%w: product %d has %d dimensions, header says %d",
+				ErrSnapshotMismatch, sd.Product.ID, len(sd.Embedding), h.Dimensions)
+		}
+		docs[i] = productDoc{
+			P:                    sd.Product,
+			Embedding:            sd.Embedding,
+			SearchText:           sd.SearchText,
+			Hash:                 sd.Hash,
+			TitleEmbedding:       sd.TitleEmbedding,
+			DescriptionEmbedding: sd.DescriptionEmbedding,
+			ImageEmbedding:       sd.ImageEmbedding,
+		}
+		// Snapshots from Save already hold unit vectors; this only costs a
+		// norm check unless the file was produced elsewhere.
+		for _, k := range []vecKind{vecCombined, vecTitle, vecDescription, vecImage} {
+			if v := docs[i].vec(k); *v != nil {
+				*v = unitVector(*v)
+			}
+		}
+		byID[sd.Product.ID] = i
+	}
+
+	ix.restoreExternalIDs(docs)
+	ix.patchMu.Lock()
+	defer ix.patchMu.Unlock()
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.docs = docs
+	ix.byID = byID
+	ix.vocab = buildVocab(docs, ix.cfg.tokenizer())
+	ix.df = buildDocFreq(docs, ix.cfg.tokenizer())
+	ix.lex = buildTermStats(docs, ix.cfg.tokenizer())
+	ix.proj = proj
+	ix.generation++
+	return nil
+}
@@ -0,0 +1,73 @@
+package searchindex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortField reads the value a product is sorted by, e.g. its rating.
+type SortField func(Product) float64
+
+// Sort fields every Index knows; RegisterSortField adds more.
+const (
+	SortPrice   = "price"
+	SortCreated = "created"
+	SortUpdated = "updated"
+)
+
+var builtinSortFields = map[string]SortField{
+	SortPrice:   func(p Product) float64 { return p.Price },
+	SortCreated: func(p Product) float64 { return float64(p.CreatedAt.Unix()) },
+	SortUpdated: func(p Product) float64 { return float64(p.UpdatedAt.Unix()) },
+}
+
+// sortDescSuffix marks a descending sort, as in "rating_desc".
+const sortDescSuffix = "_desc"
+
+// RegisterSortField makes name usable in SearchOptions.Sort, for catalog
+// attributes such as rating or discount. It replaces any field already
+// registered under name, built-in ones included.
+func (ix *Index) RegisterSortField(name string, f SortField) {
+	ix.sortMu.Lock()
+	defer ix.sortMu.Unlock()
+	if ix.sortFields == nil {
+		ix.sortFields = map[string]SortField{}
+	}
+	ix.sortFields[name] = f
+}
+
+// sortField resolves a SearchOptions.Sort value to its field and
+// direction.
+func (ix *Index) sortField(spec string) (SortField, bool, error) {
+	name, desc := strings.CutSuffix(spec, sortDescSuffix)
+	ix.sortMu.RLock()
+	f, ok := ix.sortFields[name]
+	ix.sortMu.RUnlock()
+	if !ok {
+		f, ok = builtinSortFields[name]
+	}
+	if !ok {
+		return nil, false, fmt.Errorf("%w: %q", ErrUnknownSortField, name)
+	}
+	return f, desc, nil
+}
+
+// SortBy reorders results by spec, as SearchOptions.Sort does: a
+// registered field name for ascending order, with "_desc" appended for
+// descending. Equal values keep their relevance order. It fails with
+// ErrUnknownSortField, leaving results alone, for unregistered fields.
+func (ix *Index) SortBy(results []SearchResult, spec string) error {
+	f, desc, err := ix.sortField(spec)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := f(results[i].Product), f(results[j].Product)
+		if desc {
+			return a > b
+		}
+		return a < b
+	})
+	return nil
+}
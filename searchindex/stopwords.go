@@ -0,0 +1,32 @@
+package searchindex
+
+import "strings"
+
+// DefaultStopWords are the English function words DefaultConfig treats as
+// carrying no product meaning on their own.
+var DefaultStopWords = []string{
+	"a", "an", "and", "any", "are", "as", "at", "be", "by", "for", "from",
+	"i", "in", "is", "it", "me", "my", "of", "on", "or", "some", "the",
+	"this", "that", "to", "with",
+}
+
+// TooGeneric reports whether query has nothing to search for once
+// punctuation and the configured stop words are removed, e.g. "the a of" or
+// "!!!". Search returns ErrTooGeneric for such queries without calling the
+// embedding API; callers can check first to skip other work too.
+func (ix *Index) TooGeneric(query string) bool {
+	return tooGeneric(parseHints(query).text, ix.Config())
+}
+
+func tooGeneric(q string, cfg Config) bool {
+	stop := make(map[string]bool, len(cfg.StopWords))
+	for _, w := range cfg.StopWords {
+		stop[strings.ToLower(strings.TrimSpace(w))] = true
+	}
+	for _, w := range words(cfg.tokenizer(), q) {
+		if !stop[w] {
+			return false
+		}
+	}
+	return true
+}
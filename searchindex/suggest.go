@@ -0,0 +1,60 @@
+package searchindex
+
+import (
+	"sort"
+	"strings"
+)
+
+// Suggest returns up to limit product titles for type-ahead: titles in which
+// every word of prefix begins some word, e.g. "gal s2" suggests "Samsung
+// Galaxy S23". Titles starting with the prefix come first, then more
+// popular products (higher Score). It only scans titles in memory and never
+// calls the embedding API, so it is cheap enough for every keystroke.
+func (ix *Index) Suggest(prefix string, limit int) []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	tok := ix.cfg.tokenizer()
+	pw := words(tok, prefix)
+	if len(pw) == 0 || limit <= 0 {
+		return []string{}
+	}
+
+	type cand struct {
+		title   string
+		leading bool
+		score   int
+	}
+	seen := map[string]bool{}
+	var cands []cand
+	for _, d := range ix.docs {
+		tw := words(tok, d.P.Title)
+		if prefixScore(pw, tw) < 1 {
+			continue
+		}
+		key := strings.ToLower(d.P.Title)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		cands = append(cands, cand{
+			title:   d.P.Title,
+			leading: strings.HasPrefix(tw[0], pw[0]),
+			score:   d.P.Score,
+		})
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		if a.leading != b.leading {
+			return a.leading
+		}
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return len(a.title) < len(b.title)
+	})
+	out := make([]string, 0, min(limit, len(cands)))
+	for _, c := range cands[:min(limit, len(cands))] {
+		out = append(out, c.title)
+	}
+	return out
+}
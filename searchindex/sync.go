@@ -0,0 +1,139 @@
+package searchindex
+
+import (
+	"context"
+	"time"
+)
+
+// Loader reads products from the catalog's source of truth, e.g. the
+// marketplace database, for SyncSince.
+type Loader interface {
+	// ChangedSince returns the products created or updated after since.
+	ChangedSince(ctx context.Context, since time.Time) ([]Product, error)
+	// IDs returns the IDs of every product that should be indexed, so
+	// products deleted at the source can be dropped. Products keyed by
+	// ExternalID are listed by Index.IDFor; SyncSince assigns IDs to the
+	// changed products before calling IDs.
+	IDs(ctx context.Context) ([]uint, error)
+}
+
+// SyncSummary reports what a sync changed.
+type SyncSummary struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+	// Since is the watermark the next Sync starts from: the newest
+	// UpdatedAt seen so far.
+	Since time.Time `json:"since"`
+}
+
+// Upsert adds products to the index, replacing any already indexed with the
+// same ID. Only products whose text changed are re-embedded.
+func (ix *Index) Upsert(ctx context.Context, products []Product) error {
+	ix.patchMu.Lock()
+	defer ix.patchMu.Unlock()
+	products = ix.withInternalIDs(products)
+	replace := make(map[uint]bool, len(products))
+	for _, p := range products {
+		replace[p.ID] = true
+	}
+	b, _ := ix.newPatchBuilder(func(id uint) bool { return replace[id] })
+	if err := b.Add(ctx, products); err != nil {
+		return err
+	}
+	b.Commit()
+	return nil
+}
+
+// Delete removes the products with the given IDs from the index. Unknown
+// IDs are ignored. It returns how many products were removed.
+func (ix *Index) Delete(ids ...uint) int {
+	ix.patchMu.Lock()
+	defer ix.patchMu.Unlock()
+	drop := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	b, n := ix.newPatchBuilder(func(id uint) bool { return drop[id] })
+	if n > 0 {
+		b.Commit()
+	}
+	return n
+}
+
+// SyncSince upserts the products loader reports as changed after since and
+// deletes indexed products loader no longer lists, in one commit. The
+// newest UpdatedAt seen becomes the watermark Sync continues from.
+func (ix *Index) SyncSince(ctx context.Context, loader Loader, since time.Time) (SyncSummary, error) {
+	changed, err := loader.ChangedSince(ctx, since)
+	if err != nil {
+		return SyncSummary{}, err
+	}
+	changed = ix.withInternalIDs(changed)
+	ix.patchMu.Lock()
+	defer ix.patchMu.Unlock()
+	ids, err := loader.IDs(ctx)
+	if err != nil {
+		return SyncSummary{}, err
+	}
+	live := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		live[id] = true
+	}
+	replace := make(map[uint]bool, len(changed))
+	sum := SyncSummary{Since: since}
+	for _, p := range changed {
+		replace[p.ID] = true
+		if ix.Contains(p.ID) {
+			sum.Updated++
+		} else {
+			sum.Added++
+		}
+		if p.UpdatedAt.After(sum.Since) {
+			sum.Since = p.UpdatedAt
+		}
+	}
+
+	b, dropped := ix.newPatchBuilder(func(id uint) bool { return replace[id] || !live[id] })
+	sum.Deleted = dropped - sum.Updated
+	if err := b.Add(ctx, changed); err != nil {
+		return SyncSummary{}, err
+	}
+	b.Commit()
+
+	ix.syncMu.Lock()
+	if sum.Since.After(ix.lastSync) {
+		ix.lastSync = sum.Since
+	}
+	ix.syncMu.Unlock()
+	return sum, nil
+}
+
+// Sync is SyncSince from the watermark of the last sync, or from the zero
+// time (loading everything) on the first call.
+func (ix *Index) Sync(ctx context.Context, loader Loader) (SyncSummary, error) {
+	return ix.SyncSince(ctx, loader, ix.LastSync())
+}
+
+// LastSync returns the newest product UpdatedAt seen by a sync.
+func (ix *Index) LastSync() time.Time {
+	ix.syncMu.Lock()
+	defer ix.syncMu.Unlock()
+	return ix.lastSync
+}
+
+// newPatchBuilder starts a build from the current corpus minus the
+// products drop selects, for changes that don't replace everything. It
+// also returns how many products were dropped.
+func (ix *Index) newPatchBuilder(drop func(id uint) bool) (*Builder, int) {
+	b := ix.newBuilder(true)
+	b.patch = true
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	for _, d := range ix.docs {
+		if !drop(d.P.ID) {
+			b.docs = append(b.docs, d)
+		}
+	}
+	return b, len(ix.docs) - len(b.docs)
+}
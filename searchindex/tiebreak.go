@@ -0,0 +1,59 @@
+package searchindex
+
+import "sort"
+
+// Tiebreakers accepted in Config.Tiebreakers.
+const (
+	TieUpdated = "updated_desc" // most recently updated first
+	TieCreated = "created_desc" // newest first
+	TieRating  = "rating_desc"  // highest Product.Score first
+	TieID      = "id_asc"       // lowest ID first
+)
+
+var tiebreakers = []string{TieUpdated, TieCreated, TieRating, TieID}
+
+// DefaultTiebreakers orders equal scores when Config.Tiebreakers is empty:
+// by ID, so ties come out the same way every time.
+var DefaultTiebreakers = []string{TieID}
+
+// SortResults sorts results by score, highest first, breaking ties with
+// tiebreakers in order (see Config.Tiebreakers); nil uses
+// DefaultTiebreakers. Callers that merge results from several searches use
+// it to order them the way Search does.
+func SortResults(results []SearchResult, tiebreakers []string) {
+	if len(tiebreakers) == 0 {
+		tiebreakers = DefaultTiebreakers
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := &results[i].Product, &results[j].Product
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		for _, t := range tiebreakers {
+			if c := compareTie(t, a, b); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// compareTie is negative when a sorts before b under tiebreaker t.
+func compareTie(t string, a, b *Product) int {
+	switch t {
+	case TieUpdated:
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	case TieCreated:
+		return b.CreatedAt.Compare(a.CreatedAt)
+	case TieRating:
+		return b.Score - a.Score
+	case TieID:
+		switch {
+		case a.ID < b.ID:
+			return -1
+		case a.ID > b.ID:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,190 @@
+package searchindex
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token is one lowercased word of a text and its [Start, End) rune offsets.
+type Token struct {
+	Text       string
+	Start, End int
+}
+
+// Tokenizer splits text into tokens. Every word-level feature of the index
+// (fuzzy model numbers, highlighting, hints, stop words, brand boosts, query
+// routing, variants) uses the tokenizer selected by Config.Tokenizer, so
+// they all agree on what a word is.
+type Tokenizer interface {
+	Tokenize(s string) []Token
+}
+
+// Tokenizer names accepted by Config.Tokenizer.
+const (
+	TokenizerUnicode = "" // UnicodeTokenizer (default)
+	TokenizerCJK     = "cjk"
+)
+
+// UnicodeTokenizer splits on anything that isn't a letter or digit, in any
+// script, so "Wi-Fi 6/6E" is "wi", "fi", "6", "6e".
+type UnicodeTokenizer struct {
+	// JoinCompounds keeps words joined by a hyphen or slash together
+	// without the separator, so "wi-fi" and "wifi" are the same token.
+	JoinCompounds bool
+	// SplitScripts ends a word where its letters change script and folds
+	// full-width ASCII to ASCII, so "ｉｐｈｏｎｅ手机" is "iphone", "手机".
+	// Digits belong to whichever script they follow, keeping "s23" whole.
+	SplitScripts bool
+}
+
+func (t UnicodeTokenizer) Tokenize(s string) []Token {
+	var out []Token
+	var cur []rune
+	start, i := -1, 0
+	script := scriptOther
+	flush := func(end int) {
+		if start >= 0 {
+			out = append(out, Token{Text: string(cur), Start: start, End: end})
+		}
+		cur, start, script = cur[:0], -1, scriptOther
+	}
+	for off := 0; off < len(s); i++ {
+		r, size := utf8.DecodeRuneInString(s[off:])
+		off += size
+		if t.SplitScripts {
+			r = foldWidth(r)
+		}
+		switch {
+		case isWordRune(r):
+			if t.SplitScripts {
+				if sc := scriptOf(r); sc != scriptOther {
+					if script != scriptOther && sc != script {
+						flush(i)
+					}
+					script = sc
+				}
+			}
+			if start < 0 {
+				start = i
+			}
+			cur = append(cur, unicode.ToLower(r))
+		case t.JoinCompounds && start >= 0 && (r == '-' || r == '/'):
+			// Only a separator if a word character follows.
+			if next, _ := utf8.DecodeRuneInString(s[off:]); !isWordRune(next) {
+				flush(i)
+			}
+		default:
+			flush(i)
+		}
+	}
+	flush(i)
+	return out
+}
+
+// CJKTokenizer handles text that isn't space-delimited. Runs of Han, kana
+// and Hangul are split into overlapping two-character tokens ("蓝牙耳机" is
+// "蓝牙", "牙耳", "耳机"), which match sub-words without a dictionary;
+// everything else is tokenized like UnicodeTokenizer.
+type CJKTokenizer struct {
+	UnicodeTokenizer
+}
+
+func (t CJKTokenizer) Tokenize(s string) []Token {
+	var out []Token
+	for _, tok := range t.UnicodeTokenizer.Tokenize(s) {
+		rs := []rune(tok.Text)
+		segStart := 0
+		for j := 1; j <= len(rs); j++ {
+			if j < len(rs) && isCJK(rs[j]) == isCJK(rs[segStart]) {
+				continue
+			}
+			seg := rs[segStart:j]
+			at := tok.Start + segStart
+			if !isCJK(seg[0]) || len(seg) == 1 {
+				out = append(out, Token{Text: string(seg), Start: at, End: at + len(seg)})
+			} else {
+				for k := 0; k+1 < len(seg); k++ {
+					out = append(out, Token{Text: string(seg[k : k+2]), Start: at + k, End: at + k + 2})
+				}
+			}
+			segStart = j
+		}
+	}
+	return out
+}
+
+// Scripts told apart by UnicodeTokenizer.SplitScripts. Han, kana and
+// Hangul count as one, since Japanese mixes them within a word; CJKTokenizer
+// splits those further.
+const (
+	scriptOther = iota // digits, marks and scripts not listed
+	scriptLatin
+	scriptGreek
+	scriptCyrillic
+	scriptArabic
+	scriptHebrew
+	scriptDevanagari
+	scriptThai
+	scriptCJK
+)
+
+var scriptTables = []struct {
+	script int
+	table  *unicode.RangeTable
+}{
+	{scriptLatin, unicode.Latin},
+	{scriptGreek, unicode.Greek},
+	{scriptCyrillic, unicode.Cyrillic},
+	{scriptArabic, unicode.Arabic},
+	{scriptHebrew, unicode.Hebrew},
+	{scriptDevanagari, unicode.Devanagari},
+	{scriptThai, unicode.Thai},
+}
+
+func scriptOf(r rune) int {
+	if !unicode.IsLetter(r) {
+		return scriptOther
+	}
+	if isCJK(r) {
+		return scriptCJK
+	}
+	for _, st := range scriptTables {
+		if unicode.Is(st.table, r) {
+			return st.script
+		}
+	}
+	return scriptOther
+}
+
+// foldWidth maps the full-width forms of ASCII letters, digits and
+// punctuation, common in CJK input, to ASCII.
+func foldWidth(r rune) rune {
+	if r >= '！' && r <= '～' {
+		return r - '！' + '!'
+	}
+	return r
+}
+
+func isWordRune(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// tokenizer returns the Tokenizer c selects.
+func (c Config) tokenizer() Tokenizer {
+	if c.Tokenizer == TokenizerCJK {
+		return CJKTokenizer{UnicodeTokenizer{JoinCompounds: c.JoinCompounds, SplitScripts: c.SplitScripts}}
+	}
+	return UnicodeTokenizer{JoinCompounds: c.JoinCompounds, SplitScripts: c.SplitScripts}
+}
+
+// words returns the token texts of s.
+func words(tok Tokenizer, s string) []string {
+	toks := tok.Tokenize(s)
+	out := make([]string, len(toks))
+	for i, t := range toks {
+		out[i] = t.Text
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package searchindex
+
+import (
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// TokenStats is the approximate number of tokens sent to the embedding API
+// since the Index was created, for forecasting spend. Tokens are estimated
+// at one per four characters, which is close for English text; the API
+// doesn't report counts for embedding calls.
+type TokenStats struct {
+	// Search counts query embeddings (cache misses only); Index counts
+	// product embeddings from Rebuild, Builder, Upsert and Sync.
+	Search, Index int64
+	// SearchCalls and IndexCalls count the API calls; a batch is one call.
+	SearchCalls, IndexCalls int64
+}
+
+// tokenCounter accumulates TokenStats without locks.
+type tokenCounter struct {
+	search, index           atomic.Int64
+	searchCalls, indexCalls atomic.Int64
+}
+
+// estimateTokens approximates the embedding tokens of text.
+func estimateTokens(text string) int64 {
+	return int64(utf8.RuneCountInString(text)+3) / 4
+}
+
+func (t *tokenCounter) addSearch(text string) {
+	t.search.Add(estimateTokens(text))
+	t.searchCalls.Add(1)
+}
+
+func (t *tokenCounter) addIndex(texts ...string) {
+	var n int64
+	for _, s := range texts {
+		n += estimateTokens(s)
+	}
+	t.index.Add(n)
+	t.indexCalls.Add(1)
+}
+
+// TokenStats returns the embedding tokens used so far.
+func (ix *Index) TokenStats() TokenStats {
+	return TokenStats{
+		Search:      ix.tokens.search.Load(),
+		Index:       ix.tokens.index.Load(),
+		SearchCalls: ix.tokens.searchCalls.Load(),
+		IndexCalls:  ix.tokens.indexCalls.Load(),
+	}
+}
@@ -0,0 +1,55 @@
+package searchindex
+
+import (
+	"sort"
+	"strings"
+)
+
+// variantText lists the distinct attribute values across variants, in a
+// stable order, for inclusion in the embedded search text.
+func variantText(vs []Variant) string {
+	seen := map[string]bool{}
+	var vals []string
+	for _, v := range vs {
+		for _, a := range v.Attributes {
+			k := strings.ToLower(strings.TrimSpace(a))
+			if k != "" && !seen[k] {
+				seen[k] = true
+				vals = append(vals, a)
+			}
+		}
+	}
+	sort.Strings(vals)
+	return strings.Join(vals, " ")
+}
+
+// matchVariant returns the variant whose attribute values share the most
+// words with the query, or nil when none share any.
+func matchVariant(tok Tokenizer, qWords []string, vs []Variant) *Variant {
+	if len(vs) == 0 {
+		return nil
+	}
+	q := make(map[string]bool, len(qWords))
+	for _, w := range qWords {
+		q[w] = true
+	}
+	best, bestHits := -1, 0
+	for i, v := range vs {
+		hits := 0
+		for _, a := range v.Attributes {
+			for _, w := range words(tok, a) {
+				if q[w] {
+					hits++
+				}
+			}
+		}
+		if hits > bestHits {
+			best, bestHits = i, hits
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	v := vs[best]
+	return &v
+}
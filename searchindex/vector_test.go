@@ -0,0 +1,79 @@
+package searchindex
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// cosine is the textbook cosine similarity that dot on unit vectors
+// replaces.
+func cosine(a, b []float32) float64 {
+	var ab, aa, bb float64
+	for i := range a {
+		ab += float64(a[i]) * float64(b[i])
+		aa += float64(a[i]) * float64(a[i])
+		bb += float64(b[i]) * float64(b[i])
+	}
+	if aa == 0 || bb == 0 {
+		return 0
+	}
+	return ab / math.Sqrt(aa*bb)
+}
+
+func randomVector(r *rand.Rand, n int) []float32 {
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = float32(r.NormFloat64() * 3)
+	}
+	return v
+}
+
+func TestDotOfUnitVectorsIsCosine(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 100 {
+		a, b := randomVector(r, 384), randomVector(r, 384)
+		if got, want := dot(unitVector(a), unitVector(b)), cosine(a, b); math.Abs(got-want) > 1e-5 {
+			t.Fatalf("dot of unit vectors = %v, cosine = %v", got, want)
+		}
+	}
+	if got := dot(unitVector(make([]float32, 4)), unitVector([]float32{1, 2, 3, 4})); got != 0 {
+		t.Errorf("dot with a zero vector = %v, want 0", got)
+	}
+}
+
+func TestSemanticScoreIsCosine(t *testing.T) {
+	ix, em := newTestIndex(t, DefaultConfig(1, 0), testCatalog())
+	const q = "android camera phone"
+	res, err := ix.Search(context.Background(), q, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qVec, _ := em.Embed(context.Background(), q)
+	for _, r := range res {
+		text, _ := ix.SearchText(r.Product.ID)
+		dVec, _ := em.Embed(context.Background(), text)
+		if got, want := r.Why[SignalSemantic], cosine(qVec, dVec); math.Abs(got-want) > 1e-5 {
+			t.Errorf("%q: semantic %v, want cosine %v", r.Product.Title, got, want)
+		}
+	}
+}
+
+func BenchmarkDotUnit(b *testing.B) {
+	r := rand.New(rand.NewPCG(1, 2))
+	x, y := unitVector(randomVector(r, 1536)), unitVector(randomVector(r, 1536))
+	b.ResetTimer()
+	for range b.N {
+		dot(x, y)
+	}
+}
+
+func BenchmarkCosine(b *testing.B) {
+	r := rand.New(rand.NewPCG(1, 2))
+	x, y := randomVector(r, 1536), randomVector(r, 1536)
+	b.ResetTimer()
+	for range b.N {
+		cosine(x, y)
+	}
+}
@@ -0,0 +1,91 @@
+package searchindex
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// VerifyReport is Verify's comparison of the index with its source. IDs
+// are sorted.
+type VerifyReport struct {
+	Indexed int `json:"indexed"`
+	Source  int `json:"source"`
+	// Missing are products the source has that aren't indexed, Extra
+	// are indexed products the source no longer has, and Stale are
+	// indexed products whose embedded text or UpdatedAt differ from the
+	// source's.
+	Missing []uint `json:"missing"`
+	Extra   []uint `json:"extra"`
+	Stale   []uint `json:"stale"`
+	// MissingExternal are missing products keyed by an ExternalID the
+	// index has never seen, so they have no internal ID to report.
+	MissingExternal []string `json:"missingExternal,omitempty"`
+}
+
+// OK reports whether the index matches the source.
+func (r VerifyReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Stale) == 0 && len(r.MissingExternal) == 0
+}
+
+// Verify compares the index with what loader reports, without changing
+// either: it loads every product (ChangedSince from the zero time) and
+// compares content hashes, the same ones Rebuild uses to skip unchanged
+// products. Products keyed by ExternalID are matched through IDFor, and
+// no new internal IDs are assigned. Products with nothing to embed, which
+// are never indexed, don't count as missing. It catches drift Sync missed,
+// e.g. after a failed sync or a source write that didn't bump UpdatedAt.
+func (ix *Index) Verify(ctx context.Context, loader Loader) (VerifyReport, error) {
+	products, err := loader.ChangedSince(ctx, time.Time{})
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	r := VerifyReport{Missing: []uint{}, Extra: []uint{}, Stale: []uint{}}
+	live := make(map[uint]Product, len(products))
+	var unassigned []Product
+	for _, p := range products {
+		if p.ID == 0 && p.ExternalID != "" {
+			id, ok := ix.IDFor(p.ExternalID)
+			if !ok {
+				unassigned = append(unassigned, p)
+				continue
+			}
+			p.ID = id
+		}
+		if _, dup := live[p.ID]; !dup {
+			live[p.ID] = p
+		}
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	for _, p := range unassigned {
+		_, _, ok := prepareDoc(p, productDoc{}, ix.cfg, ix.fieldSel, false)
+		if ok && !slices.Contains(r.MissingExternal, p.ExternalID) {
+			r.MissingExternal = append(r.MissingExternal, p.ExternalID)
+		}
+	}
+	r.Indexed, r.Source = len(ix.docs), len(live)+len(r.MissingExternal)
+	for id, p := range live {
+		want, _, ok := prepareDoc(p, productDoc{}, ix.cfg, ix.fieldSel, false)
+		i, indexed := ix.byID[id]
+		switch {
+		case !indexed:
+			if ok {
+				r.Missing = append(r.Missing, id)
+			}
+		case !ok || ix.docs[i].Hash != want.Hash || !ix.docs[i].P.UpdatedAt.Equal(p.UpdatedAt):
+			r.Stale = append(r.Stale, id)
+		}
+	}
+	for _, d := range ix.docs {
+		if _, ok := live[d.P.ID]; !ok {
+			r.Extra = append(r.Extra, d.P.ID)
+		}
+	}
+	slices.Sort(r.Missing)
+	slices.Sort(r.Extra)
+	slices.Sort(r.Stale)
+	slices.Sort(r.MissingExternal)
+	return r, nil
+}